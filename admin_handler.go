@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adjust/hookeye/hooks/githubsvc"
+	"github.com/adjust/hookeye/stream"
+	"golang.org/x/xerrors"
+)
+
+type StreamMessage struct {
+	Topic   string         `json:"topic"`
+	Offset  int64          `json:"offset"`
+	Time    time.Time      `json:"time"`
+	Headers stream.Headers `json:"headers,omitempty"`
+	// Data holds message's data if it's a valid JSON, otherwise the data is in DataBytes.
+	Data      json.RawMessage `json:"data,omitempty"`
+	DataBytes []byte          `json:"data_bytes,omitempty"`
+}
+
+type AdminHandler struct {
+	stream     *stream.Stream
+	deliveries *DeliveryLog
+	tenants    []*Tenant
+}
+
+func NewAdminHandler(stream *stream.Stream, deliveries *DeliveryLog, tenants []*Tenant) *AdminHandler {
+	return &AdminHandler{stream, deliveries, tenants}
+}
+
+func (h *AdminHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/stream", h.handleTopics)
+	mux.HandleFunc("/admin/stream/message", h.handleMessage)
+	mux.HandleFunc("/admin/stream/reset", h.handleReset)
+	mux.HandleFunc("/admin/stream/redrive", h.handleRedrive)
+	mux.HandleFunc("/admin/github/hooks", h.handleGithubHooks)
+	mux.HandleFunc("/admin/github/delivery", h.handleGithubDelivery)
+	mux.HandleFunc("/admin/github/cache", h.handleGithubCache)
+	mux.HandleFunc("/admin/github/cache/invalidate", h.handleGithubCacheInvalidate)
+	mux.HandleFunc("/admin/hooks/rules", h.handleHooksRules)
+}
+
+// handleTopics lists stream's topics with their consumer groups. Pass "topic" parameter to get a single topic.
+func (h *AdminHandler) handleTopics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleErrorHTTP(
+			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
+		return
+	}
+
+	keys := h.stream.Topics()
+	if key := r.URL.Query().Get("topic"); key != "" {
+		keys = []string{key}
+	}
+
+	stats := make([]stream.TopicStats, 0, len(keys))
+	for _, key := range keys {
+		topic := h.stream.Topic(key)
+		if topic == nil {
+			HandleErrorHTTP(
+				StatusError(http.StatusNotFound, fmt.Sprintf("topic %q not found", key), nil), w, r)
+			return
+		}
+		stats = append(stats, topic.Stats())
+	}
+
+	writeJSON(w, stats)
+}
+
+// handleMessage returns topic's message by offset.
+func (h *AdminHandler) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleErrorHTTP(
+			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	key := query.Get("topic")
+	topic := h.stream.Topic(key)
+	if topic == nil {
+		HandleErrorHTTP(
+			StatusError(http.StatusNotFound, fmt.Sprintf("topic %q not found", key), nil), w, r)
+		return
+	}
+
+	offset, err := strconv.ParseInt(query.Get("offset"), 10, 64)
+	if err != nil {
+		HandleErrorHTTP(
+			StatusError(http.StatusBadRequest, "bad offset", err), w, r)
+		return
+	}
+
+	e, ok, err := topic.Read(offset)
+	if err != nil {
+		HandleErrorHTTP(err, w, r)
+		return
+	} else if !ok {
+		HandleErrorHTTP(
+			StatusError(http.StatusNotFound, fmt.Sprintf("offset %d not found", offset), nil), w, r)
+		return
+	}
+
+	msg := StreamMessage{
+		Topic:   key,
+		Offset:  offset,
+		Time:    e.Time,
+		Headers: e.Headers,
+	}
+	if json.Valid(e.Data) {
+		msg.Data = e.Data
+	} else {
+		msg.DataBytes = e.Data
+	}
+
+	writeJSON(w, msg)
+}
+
+// handleReset resets consumer group's committed offset to "offset" or to the first message pushed at or after "since".
+func (h *AdminHandler) handleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		HandleErrorHTTP(
+			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	key, name := query.Get("topic"), query.Get("group")
+
+	var (
+		offset int64
+		err    error
+	)
+	switch {
+	case query.Get("offset") != "":
+		offset, err = strconv.ParseInt(query.Get("offset"), 10, 64)
+		if err != nil {
+			HandleErrorHTTP(
+				StatusError(http.StatusBadRequest, "bad offset", err), w, r)
+			return
+		}
+		offset, err = h.stream.ResetGroup(key, name, offset)
+	case query.Get("since") != "":
+		since, perr := time.Parse(time.RFC3339, query.Get("since"))
+		if perr != nil {
+			HandleErrorHTTP(
+				StatusError(http.StatusBadRequest, "bad since", perr), w, r)
+			return
+		}
+		offset, err = h.stream.ResetGroupTime(key, name, since)
+	default:
+		HandleErrorHTTP(
+			StatusError(http.StatusBadRequest, "no offset or since", nil), w, r)
+		return
+	}
+	if err != nil {
+		HandleErrorHTTP(streamError(err), w, r)
+		return
+	}
+
+	writeJSON(w, struct {
+		Topic  string `json:"topic"`
+		Group  string `json:"group"`
+		Offset int64  `json:"offset"`
+	}{key, name, offset})
+}
+
+// handleRedrive pushes the message from dead-letter topic back to the topic it came from, for the group,
+// that failed it, to process it again.
+func (h *AdminHandler) handleRedrive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		HandleErrorHTTP(
+			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	offset, err := strconv.ParseInt(query.Get("offset"), 10, 64)
+	if err != nil {
+		HandleErrorHTTP(
+			StatusError(http.StatusBadRequest, "bad offset", err), w, r)
+		return
+	}
+
+	dl, err := h.stream.Redrive(r.Context(), query.Get("topic"), offset)
+	if err != nil {
+		HandleErrorHTTP(streamError(err), w, r)
+		return
+	}
+
+	writeJSON(w, struct {
+		Topic    string `json:"topic"`
+		Offset   int64  `json:"offset"`
+		Attempts int    `json:"attempts"`
+		Error    string `json:"error"`
+	}{dl.Topic, dl.Offset, dl.Attempts, dl.Error})
+}
+
+// tenant returns the tenant by "tenant" parameter. The parameter can be omitted, if there's a single tenant.
+func (h *AdminHandler) tenant(r *http.Request) (*Tenant, error) {
+	name := r.URL.Query().Get("tenant")
+	if name == "" && len(h.tenants) == 1 {
+		return h.tenants[0], nil
+	}
+	for _, tenant := range h.tenants {
+		if tenant.Name == name {
+			return tenant, nil
+		}
+	}
+	if name == "" {
+		return nil, StatusError(http.StatusBadRequest, "no tenant", nil)
+	}
+	return nil, StatusError(http.StatusNotFound, fmt.Sprintf("tenant %q not found", name), nil)
+}
+
+// handleGithubHooks lists GitHub webhooks of the tenant, that were registered with "ping" event since the start.
+func (h *AdminHandler) handleGithubHooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleErrorHTTP(
+			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
+		return
+	}
+
+	tenant, err := h.tenant(r)
+	if err != nil {
+		HandleErrorHTTP(err, w, r)
+		return
+	}
+
+	writeJSON(w, tenant.GithubHandler.Hooks())
+}
+
+// handleGithubDelivery returns the topic and the offset, GitHub delivery "id" was published at.
+func (h *AdminHandler) handleGithubDelivery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleErrorHTTP(
+			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	d, ok := h.deliveries.Get(id)
+	if !ok {
+		HandleErrorHTTP(
+			StatusError(http.StatusNotFound, fmt.Sprintf("delivery %q not found", id), nil), w, r)
+		return
+	}
+
+	writeJSON(w, d)
+}
+
+// handleGithubCache returns the state of the tenant's cache of GitHub lookups.
+func (h *AdminHandler) handleGithubCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleErrorHTTP(
+			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
+		return
+	}
+
+	tenant, err := h.tenant(r)
+	if err != nil {
+		HandleErrorHTTP(err, w, r)
+		return
+	}
+
+	var stats githubsvc.CacheStats
+	if cache := tenant.GithubService.Cache; cache != nil {
+		stats = cache.Stats()
+	}
+	writeJSON(w, stats)
+}
+
+// handleGithubCacheInvalidate removes the tenant's cached lookups of the "project" path, or all cached lookups,
+// if no project is passed.
+func (h *AdminHandler) handleGithubCacheInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		HandleErrorHTTP(
+			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
+		return
+	}
+
+	tenant, err := h.tenant(r)
+	if err != nil {
+		HandleErrorHTTP(err, w, r)
+		return
+	}
+
+	project := r.URL.Query().Get("project")
+	removed := tenant.GithubService.InvalidateProject(project)
+
+	writeJSON(w, struct {
+		Project string `json:"project,omitempty"`
+		Removed int    `json:"removed"`
+	}{project, removed})
+}
+
+// handleHooksRules returns the tenant's active hooks rules with their version and the hash of the rules file.
+func (h *AdminHandler) handleHooksRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleErrorHTTP(
+			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
+		return
+	}
+
+	tenant, err := h.tenant(r)
+	if err != nil {
+		HandleErrorHTTP(err, w, r)
+		return
+	}
+
+	writeJSON(w, tenant.Rules.Rules())
+}
+
+// streamError maps errors, returned by the stream, to HTTP statuses.
+func streamError(err error) error {
+	if xerrors.Is(err, stream.ErrNotFound) {
+		return StatusError(http.StatusNotFound, err.Error(), err)
+	}
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
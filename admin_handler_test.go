@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/adjust/hookeye/hooks"
+	"github.com/adjust/hookeye/stream"
+	"golang.org/x/xerrors"
+)
+
+// adminHandlerTest serves AdminHandler of the stream.
+type adminHandlerTest struct {
+	stream *stream.Stream
+	srv    *httptest.Server
+}
+
+func newAdminHandlerTest(t *testing.T) *adminHandlerTest {
+	t.Helper()
+
+	deliveries, err := OpenDeliveryLog("", time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := stream.New()
+	mux := http.NewServeMux()
+	NewAdminHandler(s, deliveries, nil).RegisterRoutes(mux)
+
+	return &adminHandlerTest{
+		stream: s,
+		srv:    httptest.NewServer(mux),
+	}
+}
+
+func (at *adminHandlerTest) Close() {
+	at.srv.Close()
+	at.stream.Stop()
+}
+
+// do sends the request to the path with the params, and decodes the response into v, if the request succeeded.
+// It returns the status of the response.
+func (at *adminHandlerTest) do(t *testing.T, method, path string, params url.Values, v interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, at.srv.URL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK && v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func (at *adminHandlerTest) publish(t *testing.T, key string, data string, headers stream.Headers) {
+	t.Helper()
+
+	if _, err := at.stream.Publish(context.Background(), key, []byte(data), headers); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminHandler_Topics(t *testing.T) {
+	at := newAdminHandlerTest(t)
+	defer at.Close()
+
+	at.publish(t, "github/issues", `{"action": "opened"}`, nil)
+	at.publish(t, "github/push", `{"ref": "refs/heads/master"}`, nil)
+	at.publish(t, "github/push", `{"ref": "refs/heads/dev"}`, nil)
+
+	var stats []stream.TopicStats
+	if status := at.do(t, http.MethodGet, "/admin/stream", nil, &stats); status != http.StatusOK {
+		t.Fatalf("topics: want status 200, got %d", status)
+	}
+	if len(stats) != 2 {
+		t.Errorf("want 2 topics, got %+v", stats)
+	}
+
+	stats = nil
+	if status := at.do(t, http.MethodGet, "/admin/stream", url.Values{"topic": {"github/push"}}, &stats); status != http.StatusOK {
+		t.Fatalf("topic: want status 200, got %d", status)
+	}
+	if len(stats) != 1 || stats[0].Key != "github/push" || stats[0].Messages != 2 || stats[0].TailOffset != 2 {
+		t.Errorf("want 2 messages of github/push, got %+v", stats)
+	}
+
+	if status := at.do(t, http.MethodGet, "/admin/stream", url.Values{"topic": {"github/ping"}}, nil); status != http.StatusNotFound {
+		t.Errorf("unknown topic: want status 404, got %d", status)
+	}
+	if status := at.do(t, http.MethodPost, "/admin/stream", nil, nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("POST: want status 405, got %d", status)
+	}
+}
+
+func TestAdminHandler_Message(t *testing.T) {
+	at := newAdminHandlerTest(t)
+	defer at.Close()
+
+	at.publish(t, "github/issues", `{"action": "opened"}`, stream.Headers{hooks.HeaderEvent: "issues"})
+	at.publish(t, "raw", "not json", nil)
+
+	var msg StreamMessage
+	params := url.Values{"topic": {"github/issues"}, "offset": {"0"}}
+	if status := at.do(t, http.MethodGet, "/admin/stream/message", params, &msg); status != http.StatusOK {
+		t.Fatalf("message: want status 200, got %d", status)
+	}
+	var data bytes.Buffer
+	if err := json.Compact(&data, msg.Data); err != nil {
+		t.Fatal(err)
+	}
+	if data.String() != `{"action":"opened"}` || msg.DataBytes != nil {
+		t.Errorf("want JSON data, got %s, %q", msg.Data, msg.DataBytes)
+	}
+	if msg.Topic != "github/issues" || msg.Offset != 0 || msg.Headers.Get(hooks.HeaderEvent) != "issues" || msg.Time.IsZero() {
+		t.Errorf("want message 0 of github/issues with headers, got %+v", msg)
+	}
+
+	// data, that isn't JSON, is returned as bytes
+	msg = StreamMessage{}
+	params = url.Values{"topic": {"raw"}, "offset": {"0"}}
+	if status := at.do(t, http.MethodGet, "/admin/stream/message", params, &msg); status != http.StatusOK {
+		t.Fatalf("raw message: want status 200, got %d", status)
+	}
+	if string(msg.DataBytes) != "not json" || msg.Data != nil {
+		t.Errorf("want data bytes, got %s, %q", msg.Data, msg.DataBytes)
+	}
+
+	cases := []struct {
+		name       string
+		params     url.Values
+		wantStatus int
+	}{
+		{"unknown topic", url.Values{"topic": {"github/ping"}, "offset": {"0"}}, http.StatusNotFound},
+		{"unknown offset", url.Values{"topic": {"raw"}, "offset": {"1"}}, http.StatusNotFound},
+		{"bad offset", url.Values{"topic": {"raw"}, "offset": {"first"}}, http.StatusBadRequest},
+		{"no offset", url.Values{"topic": {"raw"}}, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if status := at.do(t, http.MethodGet, "/admin/stream/message", tc.params, nil); status != tc.wantStatus {
+			t.Errorf("%s: want status %d, got %d", tc.name, tc.wantStatus, status)
+		}
+	}
+}
+
+func TestAdminHandler_Reset(t *testing.T) {
+	at := newAdminHandlerTest(t)
+	defer at.Close()
+
+	group1 := make(chan *stream.Message, 3)
+	at.stream.SubscribeN("topic1", "group1", stream.ProcessorFunc(func(ctx context.Context, msg *stream.Message) error {
+		group1 <- msg
+		return nil
+	}), 1)
+
+	at.publish(t, "topic1", "A", nil)
+	at.publish(t, "topic1", "B", nil)
+	<-group1
+	<-group1
+
+	since := time.Now()
+
+	at.publish(t, "topic1", "C", nil)
+	<-group1
+
+	var reset struct {
+		Topic  string `json:"topic"`
+		Group  string `json:"group"`
+		Offset int64  `json:"offset"`
+	}
+	params := url.Values{"topic": {"topic1"}, "group": {"group1"}, "offset": {"1"}}
+	if status := at.do(t, http.MethodPost, "/admin/stream/reset", params, &reset); status != http.StatusOK {
+		t.Fatalf("reset: want status 200, got %d", status)
+	}
+	if reset.Topic != "topic1" || reset.Group != "group1" || reset.Offset != 1 {
+		t.Errorf("reset: want group1 of topic1 at offset 1, got %+v", reset)
+	}
+	if msg := <-group1; msg.Offset != 1 {
+		t.Errorf("reset: want message at offset 1, got %d", msg.Offset)
+	}
+	<-group1
+
+	params = url.Values{"topic": {"topic1"}, "group": {"group1"}, "since": {since.Format(time.RFC3339Nano)}}
+	if status := at.do(t, http.MethodPost, "/admin/stream/reset", params, &reset); status != http.StatusOK {
+		t.Fatalf("reset by time: want status 200, got %d", status)
+	}
+	if reset.Offset != 2 {
+		t.Errorf("reset by time: want offset 2, got %d", reset.Offset)
+	}
+	if msg := <-group1; msg.Offset != 2 {
+		t.Errorf("reset by time: want message at offset 2, got %d", msg.Offset)
+	}
+
+	cases := []struct {
+		name       string
+		method     string
+		params     url.Values
+		wantStatus int
+	}{
+		{"no offset or since", http.MethodPost, url.Values{"topic": {"topic1"}, "group": {"group1"}}, http.StatusBadRequest},
+		{"bad offset", http.MethodPost, url.Values{"topic": {"topic1"}, "group": {"group1"}, "offset": {"first"}}, http.StatusBadRequest},
+		{"bad since", http.MethodPost, url.Values{"topic": {"topic1"}, "group": {"group1"}, "since": {"yesterday"}}, http.StatusBadRequest},
+		{"unknown topic", http.MethodPost, url.Values{"topic": {"topic2"}, "group": {"group1"}, "offset": {"0"}}, http.StatusNotFound},
+		{"unknown group", http.MethodPost, url.Values{"topic": {"topic1"}, "group": {"group2"}, "offset": {"0"}}, http.StatusNotFound},
+		{"GET", http.MethodGet, url.Values{"topic": {"topic1"}, "group": {"group1"}, "offset": {"0"}}, http.StatusMethodNotAllowed},
+	}
+	for _, tc := range cases {
+		if status := at.do(t, tc.method, "/admin/stream/reset", tc.params, nil); status != tc.wantStatus {
+			t.Errorf("%s: want status %d, got %d", tc.name, tc.wantStatus, status)
+		}
+	}
+}
+
+// subscribeDeadLetter subscribes group1 to topic1, failing the first message to its dead-letter topic.
+// It returns the messages, that group1 processed, and the offset of the dead letter.
+func (at *adminHandlerTest) subscribeDeadLetter(t *testing.T) (<-chan *stream.Message, int64) {
+	t.Helper()
+
+	var failed bool
+	group1 := make(chan *stream.Message, 1)
+	at.stream.SubscribeN("topic1", "group1", stream.ProcessorFunc(func(ctx context.Context, msg *stream.Message) error {
+		if !failed {
+			failed = true
+			return stream.Permanent(xerrors.New("bad message"))
+		}
+		group1 <- msg
+		return nil
+	}), 1, stream.WithDeadLetter(stream.DeadLetterTopic("topic1")))
+
+	dlq := make(chan *stream.Message, 1)
+	at.stream.SubscribeN(stream.DeadLetterTopic("topic1"), "group1", stream.ProcessorFunc(func(ctx context.Context, msg *stream.Message) error {
+		dlq <- msg
+		return nil
+	}), 1)
+
+	at.publish(t, "topic1", "A", nil)
+
+	return group1, (<-dlq).Offset
+}
+
+func TestAdminHandler_Redrive(t *testing.T) {
+	at := newAdminHandlerTest(t)
+	defer at.Close()
+
+	group1, offset := at.subscribeDeadLetter(t)
+
+	var dl struct {
+		Topic    string `json:"topic"`
+		Offset   int64  `json:"offset"`
+		Attempts int    `json:"attempts"`
+		Error    string `json:"error"`
+	}
+	params := url.Values{"topic": {stream.DeadLetterTopic("topic1")}, "offset": {strconv.FormatInt(offset, 10)}}
+	if status := at.do(t, http.MethodPost, "/admin/stream/redrive", params, &dl); status != http.StatusOK {
+		t.Fatalf("redrive: want status 200, got %d", status)
+	}
+	if dl.Topic != "topic1" || dl.Offset != 0 || dl.Error == "" {
+		t.Errorf("redrive: want dead letter of topic1 at offset 0, got %+v", dl)
+	}
+	if msg := <-group1; string(msg.Data) != "A" {
+		t.Errorf("redrive: want message A, got %q", msg.Data)
+	}
+
+	cases := []struct {
+		name       string
+		method     string
+		params     url.Values
+		wantStatus int
+	}{
+		{"bad offset", http.MethodPost, url.Values{"topic": {stream.DeadLetterTopic("topic1")}, "offset": {"first"}}, http.StatusBadRequest},
+		{"unknown offset", http.MethodPost, url.Values{"topic": {stream.DeadLetterTopic("topic1")}, "offset": {"9"}}, http.StatusNotFound},
+		{"unknown topic", http.MethodPost, url.Values{"topic": {stream.DeadLetterTopic("topic2")}, "offset": {"0"}}, http.StatusNotFound},
+		{"GET", http.MethodGet, params, http.StatusMethodNotAllowed},
+	}
+	for _, tc := range cases {
+		if status := at.do(t, tc.method, "/admin/stream/redrive", tc.params, nil); status != tc.wantStatus {
+			t.Errorf("%s: want status %d, got %d", tc.name, tc.wantStatus, status)
+		}
+	}
+}
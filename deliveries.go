@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	defaultDeliveriesTTL  = 72 * time.Hour
+	defaultDeliveriesSize = 100000
+)
+
+// Delivery is a GitHub webhook delivery, that was published to the stream.
+type Delivery struct {
+	// ID is the GUID from "X-GitHub-Delivery" header.
+	ID         string    `json:"id"`
+	Topic      string    `json:"topic"`
+	Offset     int64     `json:"offset"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// DeliveryLog remembers recent deliveries, so the deliveries, that GitHub (or a user) redelivers, aren't published twice.
+// The log keeps at most Size deliveries, received within TTL. If it's opened with a path, the deliveries are appended
+// to the file, and are loaded back on restart.
+type DeliveryLog struct {
+	TTL  time.Duration
+	Size int
+
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	deliveries map[string]Delivery
+	// claimed are the ids of the deliveries, that are being published (see Claim)
+	claimed map[string]bool
+	// ids of the deliveries in the order they were received
+	ids []string
+	// number of records in the file, including the evicted ones
+	records int
+}
+
+// OpenDeliveryLog loads the deliveries from the file at path. If path is empty, the deliveries are kept in memory only.
+func OpenDeliveryLog(path string, ttl time.Duration, size int) (*DeliveryLog, error) {
+	if ttl <= 0 {
+		ttl = defaultDeliveriesTTL
+	}
+	if size <= 0 {
+		size = defaultDeliveriesSize
+	}
+
+	l := &DeliveryLog{
+		TTL:        ttl,
+		Size:       size,
+		path:       path,
+		deliveries: make(map[string]Delivery),
+		claimed:    make(map[string]bool),
+	}
+	if path == "" {
+		return l, nil
+	}
+
+	if err := l.load(); err != nil {
+		return nil, xerrors.Errorf("could not load deliveries %s: %w", path, err)
+	}
+	// rewrite the file without expired deliveries and a torn tail, that a crash in the middle of a write might leave
+	if err := l.compact(); err != nil {
+		return nil, xerrors.Errorf("could not compact deliveries %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func (l *DeliveryLog) load() error {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var d Delivery
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			log.Printf("github: dropping deliveries %s after bad record: %v\n", l.path, err)
+			break
+		}
+		l.add(d)
+	}
+	l.evict(time.Now())
+
+	return scanner.Err()
+}
+
+// Get returns the delivery by id. It returns false if the delivery wasn't seen within the window.
+func (l *DeliveryLog) Get(id string) (Delivery, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	d, ok := l.deliveries[id]
+	if !ok || time.Since(d.ReceivedAt) > l.TTL {
+		return Delivery{}, false
+	}
+	return d, true
+}
+
+// Claim reserves the id of the delivery, that is about to be published, so the copies of the delivery, that arrive
+// at the same time, aren't published too. It returns true, if the delivery is claimed; the claim is released
+// with Add, after the delivery is published, or with Release, if publishing fails. Otherwise, it returns
+// the published delivery, or an empty delivery, if another copy is being published.
+func (l *DeliveryLog) Claim(id string) (Delivery, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if d, ok := l.deliveries[id]; ok && time.Since(d.ReceivedAt) <= l.TTL {
+		return d, false
+	}
+	if l.claimed[id] {
+		return Delivery{}, false
+	}
+	l.claimed[id] = true
+	return Delivery{}, true
+}
+
+// Release releases the claim of the delivery, that wasn't published.
+func (l *DeliveryLog) Release(id string) {
+	l.mu.Lock()
+	delete(l.claimed, id)
+	l.mu.Unlock()
+}
+
+// Add remembers the delivery, evicting the deliveries, that fell out of the window, and releases its claim.
+func (l *DeliveryLog) Add(d Delivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.claimed, d.ID)
+	l.add(d)
+	l.evict(time.Now())
+
+	if l.file == nil {
+		return nil
+	}
+
+	// let the file grow up to twice the window before it's rewritten
+	if l.records >= 2*l.Size {
+		return l.compact()
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return xerrors.Errorf("could not write delivery: %w", err)
+	}
+	l.records++
+
+	return nil
+}
+
+func (l *DeliveryLog) add(d Delivery) {
+	if _, ok := l.deliveries[d.ID]; !ok {
+		l.ids = append(l.ids, d.ID)
+	}
+	l.deliveries[d.ID] = d
+}
+
+func (l *DeliveryLog) evict(now time.Time) {
+	var n int
+	for n < len(l.ids) {
+		d := l.deliveries[l.ids[n]]
+		if len(l.ids)-n <= l.Size && now.Sub(d.ReceivedAt) <= l.TTL {
+			break
+		}
+		delete(l.deliveries, d.ID)
+		n++
+	}
+	l.ids = l.ids[n:]
+}
+
+// compact replaces the file with the deliveries, that are in the window, and reopens it for appending.
+func (l *DeliveryLog) compact() error {
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+		l.file = nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, id := range l.ids {
+		if err := enc.Encode(l.deliveries[id]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), l.path); err != nil {
+		return err
+	}
+
+	l.file, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.records = len(l.ids)
+
+	return nil
+}
+
+func (l *DeliveryLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Sync()
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeliveryLog_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hookeye-deliveries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, deliveriesFile)
+
+	l, err := OpenDeliveryLog(path, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, id := range []string{"d1", "d2", "d3"} {
+		if err := l.Add(Delivery{ID: id, Topic: "github/issues", Offset: int64(i), ReceivedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash in the middle of a write
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"d4","top`)
+	f.Close()
+
+	l, err = OpenDeliveryLog(path, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, ok := l.Get("d1"); ok {
+		t.Errorf("d1: want evicted by size")
+	}
+	if d, ok := l.Get("d3"); !ok || d.Offset != 2 || d.Topic != "github/issues" {
+		t.Errorf("d3: want offset 2 in github/issues, got %+v (%v)", d, ok)
+	}
+	if _, ok := l.Get("d4"); ok {
+		t.Errorf("d4: want dropped torn record")
+	}
+}
+
+func TestDeliveryLog_TTL(t *testing.T) {
+	l, err := OpenDeliveryLog("", time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Add(Delivery{ID: "old", ReceivedAt: time.Now().Add(-2 * time.Minute)})
+	l.Add(Delivery{ID: "new", ReceivedAt: time.Now()})
+
+	if _, ok := l.Get("old"); ok {
+		t.Errorf("old: want expired")
+	}
+	if _, ok := l.Get("new"); !ok {
+		t.Errorf("new: want found")
+	}
+}
+
+func TestDeliveryLog_Claim(t *testing.T) {
+	l, err := OpenDeliveryLog("", time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := l.Claim("d1"); !ok {
+		t.Fatal("d1: want claimed")
+	}
+	// a copy, that arrives while the delivery is being published, isn't claimed
+	if d, ok := l.Claim("d1"); ok || d.ID != "" {
+		t.Errorf("d1: want in flight, got %+v, %v", d, ok)
+	}
+
+	// the claim of a delivery, that failed to publish, is released
+	l.Release("d1")
+	if _, ok := l.Claim("d1"); !ok {
+		t.Fatal("d1: want claimed after release")
+	}
+
+	l.Add(Delivery{ID: "d1", Topic: "github/issues", Offset: 1, ReceivedAt: time.Now()})
+	if d, ok := l.Claim("d1"); ok || d.Offset != 1 {
+		t.Errorf("d1: want published at offset 1, got %+v, %v", d, ok)
+	}
+}
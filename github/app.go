@@ -0,0 +1,250 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// jwtLifetime is the lifetime of app's JWT; GitHub accepts JWTs, that expire in 10 minutes at most.
+	jwtLifetime = 9 * time.Minute
+	// jwtClockSkew is subtracted from JWT's issue time, in case the clocks of hookeye and GitHub drift.
+	jwtClockSkew = time.Minute
+	// tokenRefreshBefore is the time before the expiry, an installation token is refreshed at.
+	tokenRefreshBefore = 5 * time.Minute
+	// tokenRequestTimeout limits the request of installation token, even if app's HTTP client has no timeout.
+	tokenRequestTimeout = time.Minute
+)
+
+// Installation is the installation of GitHub App, that sent the webhook.
+type Installation struct {
+	ID     int64  `json:"id"`
+	NodeID string `json:"node_id,omitempty"`
+}
+
+// InstallationToken is an access token of app's installation.
+type InstallationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// App authenticates as GitHub App (see https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app).
+// It signs JWTs with app's private key and exchanges them for installation access tokens, that are cached
+// until shortly before they expire.
+type App struct {
+	ID  int64
+	Key *rsa.PrivateKey
+	// APIURL is the base URL of GitHub REST API, e.g. "https://api.github.com".
+	APIURL string
+	// HTTPClient sends the requests; http.DefaultClient is used if it's nil.
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	tokens map[int64]InstallationToken
+	// pending are the requests of installation tokens in flight, so concurrent callers wait for the same request
+	pending map[int64]*tokenRequest
+	now     func() time.Time
+}
+
+// tokenRequest is a request of installation token; done is closed, when the request completes.
+type tokenRequest struct {
+	done  chan struct{}
+	token InstallationToken
+	err   error
+}
+
+func NewApp(id int64, key *rsa.PrivateKey, apiURL string) *App {
+	return &App{
+		ID:      id,
+		Key:     key,
+		APIURL:  strings.TrimSuffix(apiURL, "/"),
+		tokens:  make(map[int64]InstallationToken),
+		pending: make(map[int64]*tokenRequest),
+		now:     time.Now,
+	}
+}
+
+// LoadApp is like NewApp, but it reads app's private key from the PEM file, that GitHub generated for the app.
+func LoadApp(id int64, keyFile, apiURL string) (*App, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, xerrors.Errorf("bad private key %s: %w", keyFile, err)
+	}
+	return NewApp(id, key, apiURL), nil
+}
+
+// ParsePrivateKey parses PEM encoded RSA private key in PKCS #1 or PKCS #8 form.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, xerrors.New("no PEM data")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, xerrors.Errorf("want RSA key, got %T", key)
+	}
+	return rsaKey, nil
+}
+
+// JWT returns a JWT, signed with app's private key, to authenticate as the app.
+func (app *App) JWT() (string, error) {
+	now := app.now()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-jwtClockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": strconv.FormatInt(app.ID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, app.Key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", xerrors.Errorf("could not sign JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// InstallationToken returns an access token of the installation. The token is cached, and a new one is requested,
+// when the cached token is about to expire. Concurrent calls for the same installation wait for a single request;
+// requests of other installations aren't blocked by it.
+func (app *App) InstallationToken(ctx context.Context, installationID int64) (string, error) {
+	app.mu.Lock()
+	if token, ok := app.tokens[installationID]; ok && app.now().Add(tokenRefreshBefore).Before(token.ExpiresAt) {
+		app.mu.Unlock()
+		return token.Token, nil
+	}
+	req, ok := app.pending[installationID]
+	if !ok {
+		req = &tokenRequest{done: make(chan struct{})}
+		app.pending[installationID] = req
+	}
+	app.mu.Unlock()
+
+	if !ok {
+		go app.requestToken(installationID, req)
+	}
+
+	select {
+	case <-req.done:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if req.err != nil {
+		return "", xerrors.Errorf("could not create token of installation %d: %w", installationID, req.err)
+	}
+	return req.token.Token, nil
+}
+
+// requestToken requests installation token and caches it. The request isn't bound to a caller's context,
+// as other callers may wait for it.
+func (app *App) requestToken(installationID int64, req *tokenRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenRequestTimeout)
+	req.token, req.err = app.createInstallationToken(ctx, installationID)
+	cancel()
+
+	app.mu.Lock()
+	if req.err == nil {
+		app.tokens[installationID] = req.token
+	}
+	delete(app.pending, installationID)
+	app.mu.Unlock()
+	close(req.done)
+}
+
+func (app *App) createInstallationToken(ctx context.Context, installationID int64) (InstallationToken, error) {
+	jwt, err := app.JWT()
+	if err != nil {
+		return InstallationToken{}, err
+	}
+
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", app.APIURL, installationID)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return InstallationToken{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	httpClient := app.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return InstallationToken{}, &Error{Err: err}
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return InstallationToken{}, &Error{StatusCode: resp.StatusCode, Err: err}
+	}
+	if resp.StatusCode != http.StatusCreated {
+		var body struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &body) != nil || body.Message == "" {
+			body.Message = truncate(string(bytes.TrimSpace(data)), 200)
+		}
+		return InstallationToken{}, &Error{StatusCode: resp.StatusCode, Message: body.Message}
+	}
+
+	var token InstallationToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return InstallationToken{}, &Error{StatusCode: resp.StatusCode, Message: "could not decode token", Err: err}
+	}
+	if token.Token == "" {
+		return InstallationToken{}, &Error{StatusCode: resp.StatusCode, Message: "no token in response"}
+	}
+	return token, nil
+}
+
+type installationKey struct{}
+
+// WithInstallation returns the context, requests with which are authenticated as app's installation.
+func WithInstallation(ctx context.Context, installationID int64) context.Context {
+	return context.WithValue(ctx, installationKey{}, installationID)
+}
+
+// InstallationFromContext returns the installation, set by WithInstallation.
+func InstallationFromContext(ctx context.Context) (installationID int64, ok bool) {
+	installationID, ok = ctx.Value(installationKey{}).(int64)
+	return installationID, ok
+}
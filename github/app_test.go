@@ -0,0 +1,223 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// fakeTokens is a fake GitHub API, that creates installation tokens for the app's JWTs.
+type fakeTokens struct {
+	key *rsa.PublicKey
+	now time.Time
+
+	mu       sync.Mutex
+	requests int
+}
+
+func (f *fakeTokens) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var installationID int64
+	if _, err := fmt.Sscanf(r.URL.Path, "/app/installations/%d/access_tokens", &installationID); err != nil || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	if err := f.verify(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"message": %q}`, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	f.requests++
+	n := f.requests
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(InstallationToken{
+		Token:     fmt.Sprintf("ghs_%d_%d", installationID, n),
+		ExpiresAt: f.now.Add(time.Hour),
+	})
+}
+
+func (f *fakeTokens) verify(jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return xerrors.New("bad JWT")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(f.key, crypto.SHA256, hashed[:], sig); err != nil {
+		return err
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	if claims.Iss != "42" {
+		return xerrors.Errorf("bad issuer %q", claims.Iss)
+	}
+	if now := f.now.Unix(); claims.Iat > now || claims.Exp <= now || claims.Exp-claims.Iat > 600 {
+		return xerrors.Errorf("bad JWT lifetime %d..%d", claims.Iat, claims.Exp)
+	}
+	return nil
+}
+
+func TestApp_InstallationToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	parsedKey, err := ParsePrivateKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	fake := &fakeTokens{key: &key.PublicKey, now: now}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	app := NewApp(42, parsedKey, srv.URL+"/")
+	app.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	token, err := app.InstallationToken(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "ghs_7_1" {
+		t.Errorf("want token ghs_7_1, got %q", token)
+	}
+
+	// the token is cached, until it's about to expire
+	now = now.Add(50 * time.Minute)
+	if token, _ := app.InstallationToken(ctx, 7); token != "ghs_7_1" {
+		t.Errorf("want cached token ghs_7_1, got %q", token)
+	}
+	now = now.Add(6 * time.Minute)
+	fake.now = now
+	if token, _ := app.InstallationToken(ctx, 7); token != "ghs_7_2" {
+		t.Errorf("want refreshed token ghs_7_2, got %q", token)
+	}
+
+	// installations have their own tokens
+	if token, _ := app.InstallationToken(ctx, 8); token != "ghs_8_3" {
+		t.Errorf("want token ghs_8_3 for another installation, got %q", token)
+	}
+}
+
+func TestApp_InstallationToken_Slow(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens of installation 7 are created, when release is closed
+	release := make(chan struct{})
+	fake := &fakeTokens{key: &key.PublicKey, now: time.Now()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/app/installations/7/") {
+			<-release
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	app := NewApp(42, key, srv.URL)
+
+	// concurrent callers wait for a single request
+	var wg sync.WaitGroup
+	tokens := make([]string, 3)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = app.InstallationToken(context.Background(), 7)
+		}(i)
+	}
+
+	// a caller gives up, when its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := app.InstallationToken(ctx, 7); !xerrors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want deadline exceeded, got %v", err)
+	}
+
+	// other installations aren't blocked by the slow request
+	if token, err := app.InstallationToken(context.Background(), 8); err != nil || token != "ghs_8_1" {
+		t.Errorf("want token ghs_8_1, got %q, %v", token, err)
+	}
+
+	close(release)
+	wg.Wait()
+	for _, token := range tokens {
+		if token != "ghs_7_2" {
+			t.Errorf("want token ghs_7_2 of the single request, got %q", tokens)
+			break
+		}
+	}
+}
+
+func TestClient_Run_App(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeTokens{key: &key.PublicKey, now: time.Now()}
+	mux := http.NewServeMux()
+	mux.Handle("/app/", fake)
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data": {"auth": %q}}`, r.Header.Get("Authorization"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := NewClient(srv.URL+"/graphql", "")
+	client.App = NewApp(42, key, srv.URL)
+
+	var resp struct {
+		Auth string `json:"auth"`
+	}
+	ctx := WithInstallation(context.Background(), 7)
+	if err := client.Run(ctx, NewRequest(`query { auth }`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := "bearer ghs_7_1"; resp.Auth != want {
+		t.Errorf("want authorization %q, got %q", want, resp.Auth)
+	}
+
+	err = client.Run(context.Background(), NewRequest(`query { auth }`), &resp)
+	if !xerrors.Is(err, ErrNoInstallation) {
+		t.Errorf("want ErrNoInstallation for request without installation, got %v", err)
+	}
+}
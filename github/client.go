@@ -1,29 +1,250 @@
 package github
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
-	"github.com/machinebox/graphql"
+	"golang.org/x/xerrors"
 )
 
-type Client struct {
-	c *graphql.Client
+// Request is a GraphQL request.
+type Request struct {
+	Query     string
+	Variables map[string]interface{}
+	// Header is the headers to send with the request.
+	Header http.Header
+}
+
+func NewRequest(query string) *Request {
+	return &Request{
+		Query:  query,
+		Header: make(http.Header),
+	}
+}
+
+// Var sets the variable of the query.
+func (req *Request) Var(key string, value interface{}) {
+	if req.Variables == nil {
+		req.Variables = make(map[string]interface{})
+	}
+	req.Variables[key] = value
+}
 
+type Client struct {
 	ApiURL string
-	Token  string
+	// WebURL is the base URL of GitHub web, e.g. "https://ghe.example.com" (see Endpoints.Web);
+	// it's github.com, if it's empty.
+	WebURL string
+	// Token is the personal access token; it's used, unless the client authenticates as App.
+	Token string
+	// App makes the client to authenticate as the installation of GitHub App, that's set in request's context
+	// with WithInstallation, or as InstallationID, if the context has no installation.
+	App            *App
+	InstallationID int64
+	// HTTPClient sends the requests; http.DefaultClient is used if it's nil.
+	HTTPClient *http.Client
+	// RateLimiter pauses the requests, when the rate limit is exceeded. The requests aren't paused if it's nil.
+	// To track the budget from the headers of the responses, client's HTTP client must use RateLimitTransport
+	// with the same limiter. Every installation of App has its own rate limit, so the client, that authenticates
+	// as App, tracks every installation with a limiter of its own, that has RateLimiter's reserve
+	// (see InstallationRateLimiter).
+	RateLimiter *RateLimiter
+
+	limitersMu sync.Mutex
+	limiters   map[int64]*RateLimiter
+}
+
+type ClientOption func(c *Client)
+
+// WithHTTPClient sets the HTTP client to send the requests.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
 }
 
-func NewClient(apiURL, token string, opts ...graphql.ClientOption) *Client {
-	return &Client{
-		c:      graphql.NewClient(apiURL, opts...),
+func NewClient(apiURL, token string, opts ...ClientOption) *Client {
+	c := &Client{
 		ApiURL: apiURL,
 		Token:  token,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Run waits until the requests aren't paused by the rate limiter, runs the request and decodes response's data
+// into resp. If the query selects "rateLimit { cost remaining resetAt }", the rate limit is recorded by the limiter.
+//
+// Failed requests return *Error. If the response has both data and errors, the data is decoded into resp,
+// and the error keeps the data too (see Error.Partial).
+func (c *Client) Run(ctx context.Context, req *Request, resp interface{}) error {
+	limiter := c.rateLimiter(ctx)
+	if err := limiter.Wait(ctx); err != nil {
+		return err
+	}
+	if limiter != nil {
+		ctx = withRateLimiter(ctx, limiter)
+	}
+
+	body, err := json.Marshal(struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables,omitempty"`
+	}{req.Query, req.Variables})
+	if err != nil {
+		return xerrors.Errorf("github: could not encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, c.ApiURL, bytes.NewReader(body))
+	if err != nil {
+		return xerrors.Errorf("github: %w", err)
+	}
+	httpReq = httpReq.WithContext(ctx)
+	for key, values := range req.Header {
+		httpReq.Header[key] = values
+	}
+	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+	httpReq.Header.Set("Accept", "application/json; charset=utf-8")
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "bearer "+token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	httpResp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return &Error{Err: err}
+	}
+	defer httpResp.Body.Close()
+
+	data, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return &Error{StatusCode: httpResp.StatusCode, Err: err}
+	}
+
+	var gr struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []GraphQLError  `json:"errors"`
+		// Message is the error of a failed request, that isn't a GraphQL error, e.g. "Bad credentials"
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &gr); err != nil || (httpResp.StatusCode != http.StatusOK && len(gr.Errors) == 0) {
+		message := gr.Message
+		if message == "" {
+			message = truncate(string(bytes.TrimSpace(data)), 200)
+		}
+		return &Error{StatusCode: httpResp.StatusCode, Message: message, Err: err}
+	}
+
+	if hasData(gr.Data) {
+		var status struct {
+			RateLimit *RateLimit `json:"rateLimit"`
+		}
+		if json.Unmarshal(gr.Data, &status) == nil && status.RateLimit != nil {
+			limiter.observe(*status.RateLimit)
+		}
+		if resp != nil {
+			if err := json.Unmarshal(gr.Data, resp); err != nil && len(gr.Errors) == 0 {
+				return &Error{StatusCode: httpResp.StatusCode, Message: "could not decode data", Err: err}
+			}
+		}
+	}
+
+	if len(gr.Errors) == 0 {
+		return nil
+	}
+
+	gerr := newError(httpResp.StatusCode, gr.Errors, gr.Data)
+	if gerr.Type == ErrorTypeRateLimited {
+		// GraphQL API reports exceeded rate limit with an error in the response's body
+		_, resetAt := limiter.Remaining()
+		if !resetAt.After(time.Now()) {
+			resetAt = time.Now().Add(defaultSecondaryRateLimitWait)
+		}
+		limiter.Pause(resetAt, "primary")
+		gerr.Err = &RateLimitError{ResetAt: resetAt, Message: gerr.Message}
+	}
+	return gerr
+}
+
+// token returns the token to authenticate the request with.
+func (c *Client) token(ctx context.Context) (string, error) {
+	if c.App == nil {
+		return c.Token, nil
+	}
+	id := c.installation(ctx)
+	if id == 0 {
+		return "", ErrNoInstallation
+	}
+	return c.App.InstallationToken(ctx, id)
+}
+
+// installation returns the installation of App, the request is authenticated as.
+func (c *Client) installation(ctx context.Context) int64 {
+	if id, ok := InstallationFromContext(ctx); ok {
+		return id
+	}
+	return c.InstallationID
+}
+
+// rateLimiter returns the limiter of the token or the installation, the request is authenticated as.
+func (c *Client) rateLimiter(ctx context.Context) *RateLimiter {
+	if c.App == nil {
+		return c.RateLimiter
+	}
+	return c.InstallationRateLimiter(c.installation(ctx))
+}
+
+// InstallationRateLimiter returns the rate limiter of App's installation, or of InstallationID, if installationID is 0.
+// The limiter is created on the first call, and is named after RateLimiter and the installation, e.g. "adjust/7".
+// It returns RateLimiter, if the client doesn't authenticate as App, or RateLimiter is nil.
+func (c *Client) InstallationRateLimiter(installationID int64) *RateLimiter {
+	if installationID == 0 {
+		installationID = c.InstallationID
+	}
+	if c.App == nil || c.RateLimiter == nil || installationID == 0 {
+		return c.RateLimiter
+	}
+
+	c.limitersMu.Lock()
+	defer c.limitersMu.Unlock()
+
+	if l, ok := c.limiters[installationID]; ok {
+		return l
+	}
+	if c.limiters == nil {
+		c.limiters = make(map[int64]*RateLimiter)
+	}
+	name := c.RateLimiter.Name
+	if name == "" {
+		name = "default"
+	}
+	l := NewRateLimiter(c.RateLimiter.Reserve)
+	l.Name = name + "/" + strconv.FormatInt(installationID, 10)
+	c.limiters[installationID] = l
+	return l
+}
+
+func hasData(data json.RawMessage) bool {
+	return len(data) > 0 && string(data) != "null"
 }
 
-func (c *Client) Run(ctx context.Context, req *graphql.Request, resp interface{}) error {
-	if c.Token != "" {
-		req.Header.Add("Authorization", "bearer "+c.Token)
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
 	}
-	return c.c.Run(ctx, req, resp)
+	return s[:n] + "..."
 }
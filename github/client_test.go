@@ -0,0 +1,130 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestClient_Run_Errors(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		body       string
+		wantType   string
+		wantStatus int
+		wantPath   []interface{}
+		retryable  bool
+		partial    bool
+	}{
+		{
+			name:       "not found with partial data",
+			status:     http.StatusOK,
+			body:       `{"data": {"a": {"id": "P1"}, "b": null}, "errors": [{"type": "NOT_FOUND", "path": ["b", 0], "message": "Could not resolve to a Project with the number 404."}]}`,
+			wantType:   ErrorTypeNotFound,
+			wantStatus: http.StatusOK,
+			wantPath:   []interface{}{"b", float64(0)},
+			partial:    true,
+		},
+		{
+			name:       "forbidden",
+			status:     http.StatusOK,
+			body:       `{"data": null, "errors": [{"type": "FORBIDDEN", "message": "Resource not accessible by integration"}]}`,
+			wantType:   ErrorTypeForbidden,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "validation",
+			status:     http.StatusOK,
+			body:       `{"errors": [{"path": ["query", "a"], "extensions": {"code": "undefinedField"}, "message": "Field 'a' doesn't exist on type 'Query'"}]}`,
+			wantStatus: http.StatusOK,
+			wantPath:   []interface{}{"query", "a"},
+		},
+		{
+			name:       "internal",
+			status:     http.StatusOK,
+			body:       `{"data": null, "errors": [{"type": "INTERNAL", "message": "Something went wrong"}]}`,
+			wantType:   ErrorTypeInternal,
+			wantStatus: http.StatusOK,
+			retryable:  true,
+		},
+		{
+			name:       "bad credentials",
+			status:     http.StatusUnauthorized,
+			body:       `{"message": "Bad credentials"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "bad gateway",
+			status:     http.StatusBadGateway,
+			body:       `<html>502</html>`,
+			wantStatus: http.StatusBadGateway,
+			retryable:  true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			client := NewClient(srv.URL, "token")
+
+			var resp struct {
+				A *struct {
+					ID string `json:"id"`
+				} `json:"a"`
+			}
+			err := client.Run(context.Background(), NewRequest(`query { a { id } }`), &resp)
+
+			var gerr *Error
+			if !xerrors.As(xerrors.Errorf("wrapped: %w", err), &gerr) {
+				t.Fatalf("want *Error, got %v", err)
+			}
+			if gerr.Type != tc.wantType {
+				t.Errorf("type: want %q, got %q", tc.wantType, gerr.Type)
+			}
+			if gerr.StatusCode != tc.wantStatus {
+				t.Errorf("status: want %d, got %d", tc.wantStatus, gerr.StatusCode)
+			}
+			if !reflect.DeepEqual(gerr.Path, tc.wantPath) {
+				t.Errorf("path: want %v, got %v", tc.wantPath, gerr.Path)
+			}
+			if gerr.Retryable() != tc.retryable {
+				t.Errorf("retryable: want %v, got %v (%v)", tc.retryable, gerr.Retryable(), err)
+			}
+			if gerr.Partial() != tc.partial {
+				t.Errorf("partial: want %v, got %v", tc.partial, gerr.Partial())
+			}
+			if tc.partial && (resp.A == nil || resp.A.ID != "P1") {
+				t.Errorf("want partial data to be decoded, got %+v", resp.A)
+			}
+		})
+	}
+}
+
+func TestClient_Run_TransportError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	client := NewClient(srv.URL, "token")
+	err := client.Run(context.Background(), NewRequest(`query { a }`), nil)
+
+	var gerr *Error
+	if !xerrors.As(err, &gerr) {
+		t.Fatalf("want *Error, got %v", err)
+	}
+	if gerr.StatusCode != 0 || gerr.Err == nil {
+		t.Errorf("want transport error, got %+v", gerr)
+	}
+	if !gerr.Retryable() {
+		t.Errorf("want transport error to be retryable")
+	}
+}
@@ -0,0 +1,128 @@
+package github
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Endpoints are the URLs of GitHub APIs and web.
+type Endpoints struct {
+	// GraphQL is the endpoint of GraphQL API.
+	GraphQL string
+	// REST is the base URL of REST API v3.
+	REST string
+	// Uploads is the base URL to upload files, e.g. release assets, with REST API.
+	Uploads string
+	// Web is the base URL of GitHub web; resource paths, e.g. "/orgs/adjust/projects/13", are relative to it.
+	Web string
+}
+
+// DotComEndpoints are the endpoints of github.com.
+var DotComEndpoints = Endpoints{
+	GraphQL: "https://api.github.com/graphql",
+	REST:    "https://api.github.com",
+	Uploads: "https://uploads.github.com",
+	Web:     "https://github.com",
+}
+
+// NewEndpoints returns the endpoints of GitHub at the base URL: of github.com, if the URL is empty
+// or "https://github.com", or of GitHub Enterprise Server otherwise (see EnterpriseEndpoints).
+func NewEndpoints(baseURL string) (Endpoints, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if baseURL == "" || baseURL == DotComEndpoints.Web {
+		return DotComEndpoints, nil
+	}
+	return EnterpriseEndpoints(baseURL)
+}
+
+// EnterpriseEndpoints returns the endpoints of GitHub Enterprise Server at the base URL, e.g. "https://ghe.example.com":
+// GraphQL API is at "/api/graphql", REST API is at "/api/v3" and uploads are at "/api/uploads" of the base URL.
+func EnterpriseEndpoints(baseURL string) (Endpoints, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return Endpoints{}, xerrors.Errorf("bad GitHub Enterprise Server url %q: %w", baseURL, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return Endpoints{}, xerrors.Errorf("bad GitHub Enterprise Server url %q", baseURL)
+	}
+
+	web := u.Scheme + "://" + u.Host + u.Path
+	return Endpoints{
+		GraphQL: web + "/api/graphql",
+		REST:    web + "/api/v3",
+		Uploads: web + "/api/uploads",
+		Web:     web,
+	}, nil
+}
+
+// ResourcePath returns the resource path of the web URL, e.g. "/orgs/adjust/projects/13"
+// for "https://github.com/orgs/adjust/projects/13". The URL must be under webURL; github.com is used,
+// if webURL is empty.
+func ResourcePath(webURL, rawurl string) (string, error) {
+	if webURL == "" {
+		webURL = DotComEndpoints.Web
+	}
+	base, err := url.Parse(strings.TrimSuffix(webURL, "/"))
+	if err != nil {
+		return "", xerrors.Errorf("bad web url %q: %w", webURL, err)
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", xerrors.Errorf("bad url %q: %w", rawurl, err)
+	}
+
+	if !strings.EqualFold(u.Host, base.Host) || !strings.HasPrefix(u.Path, base.Path+"/") {
+		return "", xerrors.Errorf("url %q isn't on %s", rawurl, webURL)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(u.Path, base.Path), "/"), nil
+}
+
+// LoadCertPool returns the system's pool of root certificates, with the certificates from the PEM file added,
+// e.g. the CA of GitHub Enterprise Server.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, xerrors.Errorf("no certificates in %s", caFile)
+	}
+	return pool, nil
+}
+
+// NewTransport returns HTTP transport, configured as http.DefaultTransport, that trusts the certificates
+// from the CA file in addition to the system's roots. The transport trusts system's roots only,
+// if the file is empty.
+func NewTransport(caFile string) (*http.Transport, error) {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if caFile != "" {
+		pool, err := LoadCertPool(caFile)
+		if err != nil {
+			return nil, xerrors.Errorf("could not load CA: %w", err)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return t, nil
+}
@@ -0,0 +1,144 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewEndpoints(t *testing.T) {
+	cases := []struct {
+		baseURL string
+		want    Endpoints
+		wantErr bool
+	}{
+		{"", DotComEndpoints, false},
+		{"https://github.com/", DotComEndpoints, false},
+		{"https://ghe.example.com/", Endpoints{
+			GraphQL: "https://ghe.example.com/api/graphql",
+			REST:    "https://ghe.example.com/api/v3",
+			Uploads: "https://ghe.example.com/api/uploads",
+			Web:     "https://ghe.example.com",
+		}, false},
+		{"http://localhost:8080", Endpoints{
+			GraphQL: "http://localhost:8080/api/graphql",
+			REST:    "http://localhost:8080/api/v3",
+			Uploads: "http://localhost:8080/api/uploads",
+			Web:     "http://localhost:8080",
+		}, false},
+		{"ghe.example.com", Endpoints{}, true},
+		{"ftp://ghe.example.com", Endpoints{}, true},
+		{"https://ghe.example.com/?x=1", Endpoints{}, true},
+	}
+	for _, tc := range cases {
+		got, err := NewEndpoints(tc.baseURL)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("%q: want error %v, got %v", tc.baseURL, tc.wantErr, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: want %+v, got %+v", tc.baseURL, tc.want, got)
+		}
+	}
+}
+
+func TestResourcePath(t *testing.T) {
+	cases := []struct {
+		webURL  string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{"", "https://github.com/orgs/adjust/projects/13", "/orgs/adjust/projects/13", false},
+		{"https://ghe.example.com", "https://ghe.example.com/adjust/backend/projects/1/", "/adjust/backend/projects/1", false},
+		{"https://ghe.example.com/", "https://GHE.example.com/orgs/adjust/projects/13", "/orgs/adjust/projects/13", false},
+		{"https://ghe.example.com", "https://github.com/orgs/adjust/projects/13", "", true},
+		{"https://ghe.example.com", "orgs/adjust/projects/13", "", true},
+		{"https://ghe.example.com", "https://ghe.example.com", "", true},
+	}
+	for _, tc := range cases {
+		got, err := ResourcePath(tc.webURL, tc.url)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("%q on %q: want error %v, got %v", tc.url, tc.webURL, tc.wantErr, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q on %q: want %q, got %q", tc.url, tc.webURL, tc.want, got)
+		}
+	}
+}
+
+func TestNewTransport_Enterprise(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// GitHub Enterprise Server with a certificate, that isn't signed by system's roots
+	mux := http.NewServeMux()
+	mux.Handle("/api/v3/app/", http.StripPrefix("/api/v3", &fakeTokens{key: &key.PublicKey, now: time.Now()}))
+	mux.HandleFunc("/api/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data": {"auth": %q}}`, r.Header.Get("Authorization"))
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "hookeye-github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, err := EnterpriseEndpoints(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newClient := func(caFile string) *Client {
+		transport, err := NewTransport(caFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpClient := &http.Client{Transport: transport}
+		client := NewClient(endpoints.GraphQL, "", WithHTTPClient(httpClient))
+		client.App = NewApp(42, key, endpoints.REST)
+		client.App.HTTPClient = httpClient
+		return client
+	}
+
+	var resp struct {
+		Auth string `json:"auth"`
+	}
+	ctx := WithInstallation(context.Background(), 7)
+
+	if err := newClient(caFile).Run(ctx, NewRequest(`query { auth }`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := "bearer ghs_7_1"; resp.Auth != want {
+		t.Errorf("want authorization %q, got %q", want, resp.Auth)
+	}
+
+	// server's certificate isn't trusted without the CA
+	if err := newClient("").Run(ctx, NewRequest(`query { auth }`), &resp); err == nil {
+		t.Error("want error for untrusted certificate")
+	}
+
+	if _, err := NewTransport(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("want error for missing CA file")
+	}
+}
@@ -0,0 +1,170 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Types of GraphQL errors, as GitHub reports them in "type" of an error. Errors of queries, that don't match
+// the schema, have no type.
+const (
+	ErrorTypeNotFound      = "NOT_FOUND"
+	ErrorTypeForbidden     = "FORBIDDEN"
+	ErrorTypeRateLimited   = "RATE_LIMITED"
+	ErrorTypeUnprocessable = "UNPROCESSABLE"
+	ErrorTypeInternal      = "INTERNAL"
+)
+
+// ErrNoInstallation is returned, when the client authenticates as App, but the request has no installation.
+var ErrNoInstallation error = permanentError("github: no app installation to authenticate the request")
+
+// permanentError is an error, that doesn't go away, if the request is sent again.
+type permanentError string
+
+func (e permanentError) Error() string {
+	return string(e)
+}
+
+func (e permanentError) Retryable() bool {
+	return false
+}
+
+// GraphQLError is an error from "errors" of GraphQL response.
+type GraphQLError struct {
+	Type    string `json:"type,omitempty"`
+	Message string `json:"message"`
+	// Path is the path of the field, that failed, e.g. ["organization", "project"]; list indices are numbers.
+	Path []interface{} `json:"path,omitempty"`
+	// Extensions hold the details of validation errors, e.g. {"code": "undefinedField"}.
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e GraphQLError) Error() string {
+	var b strings.Builder
+	if e.Type != "" {
+		b.WriteString(e.Type)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Message)
+	if len(e.Path) > 0 {
+		fmt.Fprintf(&b, " (path %s)", e.PathString())
+	}
+	return b.String()
+}
+
+// PathString joins the path with dots, e.g. "repository.issues.0.title".
+func (e GraphQLError) PathString() string {
+	parts := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		parts[i] = fmt.Sprint(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Error is returned by Client.Run, when the request fails. It's either a transport failure (Err is set,
+// StatusCode is 0), a failed HTTP request (StatusCode isn't 200), or GraphQL errors in the response (Errors are set).
+type Error struct {
+	// Type is the type of the first GraphQL error.
+	Type    string
+	Message string
+	// Path is the path of the first GraphQL error.
+	Path []interface{}
+	// StatusCode is the HTTP status of the response; it's 0, if no response was received.
+	StatusCode int
+	// Errors are all GraphQL errors of the response.
+	Errors []GraphQLError
+	// Data is the data of the response, if some fields were resolved despite the errors.
+	Data json.RawMessage
+	// Err is the cause of the failure, e.g. a transport error.
+	Err error
+}
+
+func newError(statusCode int, errs []GraphQLError, data json.RawMessage) *Error {
+	e := &Error{
+		Type:       errs[0].Type,
+		Message:    errs[0].Message,
+		Path:       errs[0].Path,
+		StatusCode: statusCode,
+		Errors:     errs,
+	}
+	if hasData(data) {
+		e.Data = data
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("github: ")
+	switch {
+	case len(e.Errors) > 0:
+		b.WriteString(e.Errors[0].Error())
+		if len(e.Errors) > 1 {
+			fmt.Fprintf(&b, " (and %d more errors)", len(e.Errors)-1)
+		}
+	case e.StatusCode != 0:
+		fmt.Fprintf(&b, "%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+		if e.Message != "" {
+			b.WriteString(": ")
+			b.WriteString(e.Message)
+		}
+	}
+	if e.Err != nil {
+		if b.Len() > len("github: ") {
+			b.WriteString(": ")
+		}
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Partial reports whether the response has data, despite the errors.
+func (e *Error) Partial() bool {
+	return len(e.Data) > 0
+}
+
+// Retryable reports whether the request may succeed, if it's sent again: transport failures, server errors
+// and exceeded rate limits are retryable; missing objects, denied access and invalid queries aren't.
+func (e *Error) Retryable() bool {
+	var rerr interface {
+		Retryable() bool
+	}
+	if e.Err != nil && xerrors.As(e.Err, &rerr) {
+		return rerr.Retryable()
+	}
+
+	if len(e.Errors) > 0 {
+		switch e.Type {
+		case ErrorTypeRateLimited, ErrorTypeInternal:
+			return true
+		default:
+			return false
+		}
+	}
+
+	switch {
+	case e.StatusCode == 0, e.StatusCode == http.StatusOK:
+		return true
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrorType returns the type of GraphQL error in err's chain, or "" if there's no such error.
+func ErrorType(err error) string {
+	var gerr *Error
+	if xerrors.As(err, &gerr) {
+		return gerr.Type
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package github
+
+type EventAction string
+
+// Actions of "issues" event (see https://developer.github.com/v3/activity/events/types/#issuesevent).
+const (
+	EventOpened       = EventAction("opened")
+	EventEdited       = EventAction("edited")
+	EventDeleted      = EventAction("deleted")
+	EventClosed       = EventAction("closed")
+	EventReopened     = EventAction("reopened")
+	EventAssigned     = EventAction("assigned")
+	EventUnassigned   = EventAction("unassigned")
+	EventLabeled      = EventAction("labeled")
+	EventUnlabeled    = EventAction("unlabeled")
+	EventTransferred  = EventAction("transferred")
+	EventMilestoned   = EventAction("milestoned")
+	EventDemilestoned = EventAction("demilestoned")
+	EventPinned       = EventAction("pinned")
+	EventUnpinned     = EventAction("unpinned")
+	EventLocked       = EventAction("locked")
+	EventUnlocked     = EventAction("unlocked")
+)
+
+type IssuesEvent struct {
+	Action     EventAction `json:"action"`
+	Issue      Issue       `json:"issue"`
+	Repository Repository  `json:"repository"`
+	// Installation is set, if the webhook belongs to GitHub App.
+	Installation *Installation `json:"installation,omitempty"`
+}
+
+type PullRequest struct {
+	BaseEntity
+
+	Number int    `json:"number"`
+	State  string `json:"state"`
+	Title  string `json:"title"`
+	Draft  bool   `json:"draft"`
+}
+
+type PullRequestEvent struct {
+	Action      EventAction `json:"action"`
+	Number      int         `json:"number"`
+	PullRequest PullRequest `json:"pull_request"`
+	Repository  Repository  `json:"repository"`
+	// Installation is set, if the webhook belongs to GitHub App.
+	Installation *Installation `json:"installation,omitempty"`
+}
+
+type Hook struct {
+	ID     int64                  `json:"id"`
+	Type   string                 `json:"type"`
+	Name   string                 `json:"name"`
+	Active bool                   `json:"active"`
+	Events []string               `json:"events"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// PingEvent is sent by GitHub, when a new webhook is created.
+type PingEvent struct {
+	Zen        string     `json:"zen"`
+	HookID     int64      `json:"hook_id"`
+	Hook       Hook       `json:"hook"`
+	Repository Repository `json:"repository"`
+}
@@ -39,6 +39,7 @@ type Repository struct {
 	BaseEntity
 
 	Name        string `json:"name"`
+	FullName    string `json:"full_name,omitempty"`
 	Description string `json:"description,omitempty"`
 }
 
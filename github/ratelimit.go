@@ -0,0 +1,245 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// rateLimitRemaining is the number of points left in the current rate limit window by the name of the limiter
+	rateLimitRemaining = expvar.NewMap("github_rate_limit_remaining")
+	// rateLimitCost is the total cost of GraphQL queries, as reported by GitHub
+	rateLimitCost = expvar.NewInt("github_rate_limit_cost")
+	// rateLimitPauses counts the pauses of requests to GitHub by the reason: "budget", "primary" or "secondary"
+	rateLimitPauses = expvar.NewMap("github_rate_limit_pauses")
+)
+
+// defaultSecondaryRateLimitWait is the time to wait after a secondary rate limit response without Retry-After header
+// (see https://docs.github.com/en/rest/overview/resources-in-the-rest-api#secondary-rate-limits).
+const defaultSecondaryRateLimitWait = time.Minute
+
+// RateLimit is the rate limit status of GraphQL API, as it's returned by "rateLimit { cost remaining resetAt }".
+type RateLimit struct {
+	Cost      int       `json:"cost"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+// RateLimitError is returned when GitHub rejects the request, because the rate limit is exceeded.
+type RateLimitError struct {
+	// ResetAt is the time, the requests may be sent again.
+	ResetAt time.Time
+	// Secondary is true, if the request hit a secondary rate limit, that guards against abuse.
+	Secondary bool
+	Message   string
+}
+
+func (e *RateLimitError) Error() string {
+	kind := "primary"
+	if e.Secondary {
+		kind = "secondary"
+	}
+	return fmt.Sprintf("github: %s rate limit exceeded until %s: %s", kind, e.ResetAt.Format(time.RFC3339), e.Message)
+}
+
+// Retryable reports that the request may succeed after the rate limit resets.
+func (e *RateLimitError) Retryable() bool {
+	return true
+}
+
+// RateLimiter keeps track of the rate limit budget and pauses the requests until the rate limit window resets,
+// when the budget is spent or GitHub rejects a request. A nil RateLimiter never pauses the requests.
+type RateLimiter struct {
+	// Name is the name of the limiter in the metrics; it's "default" if it's empty.
+	Name string
+	// Reserve is the number of points of the budget, that are kept unused; the requests are paused,
+	// when the remaining budget drops to the reserve.
+	Reserve int
+
+	mu          sync.Mutex
+	remaining   int
+	resetAt     time.Time
+	pausedUntil time.Time
+}
+
+func NewRateLimiter(reserve int) *RateLimiter {
+	return &RateLimiter{
+		Reserve:   reserve,
+		remaining: -1,
+	}
+}
+
+// Wait blocks until the requests aren't paused or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		d := time.Until(l.pausedUntil)
+		l.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Remaining returns the remaining budget and the time the budget resets; remaining is -1 if it's unknown yet.
+func (l *RateLimiter) Remaining() (remaining int, resetAt time.Time) {
+	if l == nil {
+		return -1, time.Time{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.remaining, l.resetAt
+}
+
+// Update records the remaining budget and pauses the requests till resetAt, if the budget is spent.
+func (l *RateLimiter) Update(remaining int, resetAt time.Time) {
+	if l == nil {
+		return
+	}
+	name := l.Name
+	if name == "" {
+		name = "default"
+	}
+	v := new(expvar.Int)
+	v.Set(int64(remaining))
+	rateLimitRemaining.Set(name, v)
+
+	l.mu.Lock()
+	l.remaining, l.resetAt = remaining, resetAt
+	l.mu.Unlock()
+
+	if remaining <= l.Reserve {
+		l.Pause(resetAt, "budget")
+	}
+}
+
+// Pause pauses the requests until the time.
+func (l *RateLimiter) Pause(until time.Time, reason string) {
+	if l == nil || !until.After(time.Now()) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !until.After(l.pausedUntil) {
+		return
+	}
+	l.pausedUntil = until
+	rateLimitPauses.Add(reason, 1)
+	log.Printf("github: pausing requests until %s (%s rate limit)\n", until.Format(time.RFC3339), reason)
+}
+
+// observe records the rate limit, returned by a query.
+func (l *RateLimiter) observe(rl RateLimit) {
+	rateLimitCost.Add(int64(rl.Cost))
+	l.Update(rl.Remaining, rl.ResetAt)
+}
+
+// RateLimitTransport is an http.RoundTripper, that tracks the rate limit budget from the responses of GitHub API
+// ("X-RateLimit-Remaining" and "X-RateLimit-Reset" headers), and turns the responses, that report exceeded
+// primary or secondary rate limit, into RateLimitError.
+type RateLimitTransport struct {
+	// Limiter tracks the budget of the requests, that have no limiter of their own in the context,
+	// e.g. a limiter of App's installation, set by Client.Run.
+	Limiter *RateLimiter
+	// Base is the transport to send the requests; http.DefaultTransport is used if it's nil.
+	Base http.RoundTripper
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := t.Limiter
+	if l, ok := req.Context().Value(rateLimiterKey{}).(*RateLimiter); ok {
+		limiter = l
+	}
+
+	remaining, resetAt, ok := parseRateLimitHeaders(resp.Header)
+	if ok {
+		limiter.Update(remaining, resetAt)
+	}
+
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rerr := &RateLimitError{
+		Message: strings.TrimSpace(string(body)),
+	}
+	switch {
+	case resp.Header.Get("Retry-After") != "":
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		rerr.ResetAt = time.Now().Add(time.Duration(secs) * time.Second)
+		rerr.Secondary = true
+	case ok && remaining == 0:
+		rerr.ResetAt = resetAt
+	case bytes.Contains(bytes.ToLower(body), []byte("secondary rate limit")):
+		rerr.ResetAt = time.Now().Add(defaultSecondaryRateLimitWait)
+		rerr.Secondary = true
+	default:
+		// it's not a rate limit, e.g. the token has no access to the resource
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+
+	reason := "primary"
+	if rerr.Secondary {
+		reason = "secondary"
+	}
+	limiter.Pause(rerr.ResetAt, reason)
+
+	return nil, rerr
+}
+
+type rateLimiterKey struct{}
+
+// withRateLimiter returns the context, requests with which are tracked by the limiter in RateLimitTransport.
+func withRateLimiter(ctx context.Context, l *RateLimiter) context.Context {
+	return context.WithValue(ctx, rateLimiterKey{}, l)
+}
+
+func parseRateLimitHeaders(h http.Header) (remaining int, resetAt time.Time, ok bool) {
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return remaining, time.Unix(reset, 0), true
+}
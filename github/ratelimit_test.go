@@ -0,0 +1,193 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestClient_Run_RateLimit(t *testing.T) {
+	resetAt := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	cases := []struct {
+		name      string
+		handler   http.HandlerFunc
+		remaining int
+		// wantErr is the kind of RateLimitError, the request fails with; it's empty, if the request doesn't fail
+		// with RateLimitError
+		wantErr string
+		paused  bool
+	}{
+		{
+			name: "budget",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"data": {"rateLimit": {"cost": 1, "remaining": 5, "resetAt": %q}}}`, resetAt.Format(time.RFC3339))
+			},
+			remaining: 5,
+			paused:    true,
+		},
+		{
+			name: "headers",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-RateLimit-Remaining", "4000")
+				w.Header().Set("X-RateLimit-Reset", fmt.Sprint(resetAt.Unix()))
+				w.Write([]byte(`{"data": {}}`))
+			},
+			remaining: 4000,
+		},
+		{
+			name: "primary",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", fmt.Sprint(resetAt.Unix()))
+				http.Error(w, `{"message": "API rate limit exceeded"}`, http.StatusForbidden)
+			},
+			remaining: 0,
+			wantErr:   "primary",
+			paused:    true,
+		},
+		{
+			name: "secondary",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "60")
+				http.Error(w, `{"message": "You have exceeded a secondary rate limit"}`, http.StatusForbidden)
+			},
+			remaining: -1,
+			wantErr:   "secondary",
+			paused:    true,
+		},
+		{
+			name: "forbidden",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"message": "Resource not accessible by integration"}`, http.StatusForbidden)
+			},
+			remaining: -1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+
+			limiter := NewRateLimiter(10)
+			client := NewClient(srv.URL, "token", WithHTTPClient(&http.Client{
+				Transport: &RateLimitTransport{Limiter: limiter},
+			}))
+			client.RateLimiter = limiter
+
+			err := client.Run(context.Background(), NewRequest(`query { rateLimit { cost remaining resetAt } }`), nil)
+
+			var rerr *RateLimitError
+			if tc.wantErr == "" && xerrors.As(err, &rerr) {
+				t.Errorf("want no rate limit error, got %v", err)
+			}
+			if tc.wantErr != "" {
+				if !xerrors.As(err, &rerr) {
+					t.Fatalf("want rate limit error, got %v", err)
+				}
+				if secondary := tc.wantErr == "secondary"; rerr.Secondary != secondary {
+					t.Errorf("want secondary %v, got %v", secondary, rerr.Secondary)
+				}
+			}
+
+			if remaining, _ := limiter.Remaining(); remaining != tc.remaining {
+				t.Errorf("remaining: want %d, got %d", tc.remaining, remaining)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if paused := limiter.Wait(ctx) != nil; paused != tc.paused {
+				t.Errorf("paused: want %v, got %v", tc.paused, paused)
+			}
+		})
+	}
+}
+
+func TestClient_Run_InstallationRateLimit(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetAt := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	// installation 7 has spent its budget
+	mux := http.NewServeMux()
+	mux.Handle("/app/", &fakeTokens{key: &key.PublicKey, now: time.Now()})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		remaining := 4000
+		if strings.HasPrefix(r.Header.Get("Authorization"), "bearer ghs_7_") {
+			remaining = 0
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(resetAt.Unix()))
+		w.Write([]byte(`{"data": {}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	limiter := NewRateLimiter(10)
+	limiter.Name = "adjust"
+	client := NewClient(srv.URL+"/graphql", "", WithHTTPClient(&http.Client{
+		Transport: &RateLimitTransport{Limiter: limiter},
+	}))
+	client.App = NewApp(42, key, srv.URL)
+	client.InstallationID = 8
+	client.RateLimiter = limiter
+
+	for _, id := range []int64{7, 8} {
+		if err := client.Run(WithInstallation(context.Background(), id), NewRequest(`query { viewer { login } }`), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		installationID int64
+		remaining      int
+		paused         bool
+	}{
+		{7, 0, true},
+		{8, 4000, false},
+		// requests without installation are authenticated as the default installation
+		{0, 4000, false},
+	}
+	for _, tc := range cases {
+		l := client.InstallationRateLimiter(tc.installationID)
+		if remaining, _ := l.Remaining(); remaining != tc.remaining {
+			t.Errorf("installation %d: want remaining %d, got %d", tc.installationID, tc.remaining, remaining)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if paused := l.Wait(ctx) != nil; paused != tc.paused {
+			t.Errorf("installation %d: want paused %v, got %v", tc.installationID, tc.paused, paused)
+		}
+		cancel()
+	}
+	if name := client.InstallationRateLimiter(7).Name; name != "adjust/7" {
+		t.Errorf("want limiter adjust/7, got %q", name)
+	}
+	if remaining, _ := limiter.Remaining(); remaining != -1 {
+		t.Errorf("want installations' budgets to be tracked apart from app's limiter, got remaining %d", remaining)
+	}
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	limiter := NewRateLimiter(0)
+	until := time.Now().Add(20 * time.Millisecond)
+	limiter.Pause(until, "secondary")
+
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if now := time.Now(); now.Before(until) {
+		t.Errorf("want to wait until the pause ends, stopped %v before", until.Sub(now))
+	}
+}
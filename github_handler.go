@@ -1,55 +1,105 @@
 package main
 
 import (
-	"context"
-	"crypto/hmac"
-	"crypto/sha1"
-	"encoding/hex"
 	"encoding/json"
+	"expvar"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/adjust/hookeye/github"
+	"github.com/adjust/hookeye/hooks"
 	"github.com/adjust/hookeye/stream"
 	"golang.org/x/xerrors"
 )
 
 const (
-	GithubEventIssues = "issues"
+	GithubEventPing        = "ping"
+	GithubEventIssues      = "issues"
+	GithubEventPullRequest = "pull_request"
 )
 
-type EventAction string
+// githubSkippedEvents counts the deliveries, that weren't published, as no hook subscribes to their event type
+var githubSkippedEvents = expvar.NewMap("github_skipped_events")
 
-const (
-	EventOpened     = EventAction("opened")
-	EventEdited     = EventAction("edited")
-	EventDeleted    = EventAction("deleted")
-	EventClosed     = EventAction("closed")
-	EventReopened   = EventAction("reopened")
-	EventAssigned   = EventAction("assigned")
-	EventUnassigned = EventAction("unassigned")
-)
+type IssuesEventPayload struct {
+	Action github.EventAction `json:"action"`
+	Issue  json.RawMessage    `json:"issue"`
+}
 
-var ErrNoSignature = xerrors.New("no signature")
+// eventMetadata is the part of event's payload, that is common for most of the event types.
+type eventMetadata struct {
+	Action       string               `json:"action"`
+	Repository   github.Repository    `json:"repository"`
+	Installation *github.Installation `json:"installation"`
+}
 
-type IssuesEventPayload struct {
-	Action EventAction     `json:"action"`
-	Issue  json.RawMessage `json:"issue"`
+// EventValidator checks the payload of GitHub event, before the event is published to the stream.
+type EventValidator func(payload []byte) error
+
+// RegisteredHook is a webhook, that GitHub pinged the handler for.
+type RegisteredHook struct {
+	github.Hook
+
+	// Repository is the name of the repository for repository's webhook
+	Repository string    `json:"repository,omitempty"`
+	PingedAt   time.Time `json:"pinged_at"`
+	// UnconsumedEvents are the events, the hook is subscribed to, which topics have no subscribers
+	UnconsumedEvents []string `json:"unconsumed_events,omitempty"`
 }
 
 type GithubHandler struct {
-	stream *stream.Stream
-	secret string
+	// tenant is the name of the tenant, the handler receives webhooks for; it's empty for the default tenant
+	tenant     string
+	stream     *stream.Stream
+	verifier   *SignatureVerifier
+	deliveries *DeliveryLog
+
+	// validators of the payloads by event type; events without a validator are published as is
+	validators map[string]EventValidator
+
+	hooksMu sync.Mutex
+	hooks   map[int64]*RegisteredHook
+}
+
+func NewGithubHandler(tenant string, stream *stream.Stream, verifier *SignatureVerifier, deliveries *DeliveryLog) *GithubHandler {
+	h := &GithubHandler{
+		tenant:     tenant,
+		stream:     stream,
+		verifier:   verifier,
+		deliveries: deliveries,
+		validators: make(map[string]EventValidator),
+		hooks:      make(map[int64]*RegisteredHook),
+	}
+	h.RegisterEvent(GithubEventIssues, validateIssuesEvent)
+	return h
 }
 
-func NewGithubHandler(stream *stream.Stream, secret string) *GithubHandler {
-	return &GithubHandler{stream, secret}
+// RegisterEvent sets the validator for the payloads of the event type.
+// It must be called before the handler serves requests.
+func (h *GithubHandler) RegisterEvent(event string, validate EventValidator) {
+	h.validators[event] = validate
 }
 
+// RegisterRoutes registers the handler at "/github" for the default tenant, or at "/github/<tenant>".
 func (h *GithubHandler) RegisterRoutes(mux *http.ServeMux) {
-	mux.Handle("/github", h)
+	if h.tenant == "" {
+		mux.Handle("/github", h)
+	} else {
+		mux.Handle("/github/"+h.tenant, h)
+	}
+}
+
+// GithubTopic returns the topic, GitHub events of the type are published to.
+func GithubTopic(event string) string {
+	return "github/" + event
 }
 
 func (h *GithubHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -57,13 +107,18 @@ func (h *GithubHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		HandleErrorHTTP(
 			StatusError(http.StatusMethodNotAllowed, "method not allowed", nil), w, r)
 		return
-	} else if event := r.Header.Get("X-GitHub-Event"); event != GithubEventIssues {
+	} else if event := r.Header.Get("X-GitHub-Event"); !isValidEventName(event) {
 		HandleErrorHTTP(
-			StatusError(http.StatusBadRequest, fmt.Sprintf("not supported event %q", event), nil), w, r)
+			StatusError(http.StatusBadRequest, fmt.Sprintf("bad event %q", event), nil), w, r)
 		return
 	}
 
-	err := h.handleIssuesRequest(w, r)
+	var err error
+	if r.Header.Get("X-GitHub-Event") == GithubEventPing {
+		err = h.handlePingRequest(w, r)
+	} else {
+		err = h.handleEventRequest(w, r)
+	}
 	if err != nil {
 		HandleErrorHTTP(err, w, r)
 		return
@@ -72,56 +127,176 @@ func (h *GithubHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, "OK")
 }
 
-func (h *GithubHandler) handleIssuesRequest(w http.ResponseWriter, r *http.Request) error {
-	event := &IssuesEventPayload{}
-	if err := readRequest(r, h.secret, event); err != nil {
+// Hooks returns webhooks, that GitHub pinged the handler for, ordered by id.
+func (h *GithubHandler) Hooks() []RegisteredHook {
+	h.hooksMu.Lock()
+	hooks := make([]RegisteredHook, 0, len(h.hooks))
+	for _, hook := range h.hooks {
+		hooks = append(hooks, *hook)
+	}
+	h.hooksMu.Unlock()
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].ID < hooks[j].ID
+	})
+
+	return hooks
+}
+
+// handlePingRequest records the webhook from "ping" event, that GitHub sends when the webhook is created.
+func (h *GithubHandler) handlePingRequest(w http.ResponseWriter, r *http.Request) error {
+	event := &github.PingEvent{}
+	if _, err := readRequest(r, h.verifier, event); err != nil {
 		return StatusError(http.StatusBadRequest, "bad event", err)
 	}
 
-	switch event.Action {
-	case EventOpened:
-		return h.handleIssueOpened(r.Context(), event)
-	default:
-		return StatusError(http.StatusBadRequest, fmt.Sprintf("not supported event action %q", event.Action), nil)
+	hook := &RegisteredHook{
+		Hook:       event.Hook,
+		Repository: event.Repository.Name,
+		PingedAt:   time.Now(),
+	}
+	if hook.ID == 0 {
+		hook.ID = event.HookID
 	}
-}
 
-func (h *GithubHandler) handleIssueOpened(ctx context.Context, event *IssuesEventPayload) error {
-	return h.stream.Push(ctx, githubIssuesTopic, event.Issue)
+	for _, ev := range hook.Events {
+		if ev == "*" || !h.stream.HasSubscribers(GithubTopic(ev)) {
+			hook.UnconsumedEvents = append(hook.UnconsumedEvents, ev)
+		}
+	}
+	if len(hook.UnconsumedEvents) > 0 {
+		log.Printf("github: hook %d is subscribed to events no processor consumes: %s\n", hook.ID, strings.Join(hook.UnconsumedEvents, ", "))
+	}
+
+	h.hooksMu.Lock()
+	h.hooks[hook.ID] = hook
+	h.hooksMu.Unlock()
+
+	return nil
 }
 
-func readRequest(r *http.Request, secret string, v interface{}) error {
-	body, err := ioutil.ReadAll(r.Body)
+// handleEventRequest publishes the whole event's payload to event type's topic.
+// A delivery, that was already published, or which topic has no subscribers, is accepted without publishing it.
+// A copy of the delivery, that arrives, while the delivery is being published, is rejected with 409 Conflict.
+func (h *GithubHandler) handleEventRequest(w http.ResponseWriter, r *http.Request) error {
+	event := r.Header.Get("X-GitHub-Event")
+	deliveryID := r.Header.Get("X-GitHub-Delivery")
+
+	var meta eventMetadata
+	body, err := readRequest(r, h.verifier, &meta)
 	if err != nil {
-		return err
+		return StatusError(http.StatusBadRequest, "bad event", err)
+	}
+
+	if validate := h.validators[event]; validate != nil {
+		if err := validate(body); err != nil {
+			return err
+		}
+	}
+
+	topic := GithubTopic(event)
+	// topics without consumer groups aren't compacted, so events no hook processes would be kept forever
+	if !h.stream.HasSubscribers(topic) {
+		githubSkippedEvents.Add(event, 1)
+		return nil
 	}
 
-	hubSig := r.Header.Get("X-Hub-Signature")
-	if err := verifyRequest(secret, hubSig, body); err != nil {
+	if deliveryID != "" {
+		d, ok := h.deliveries.Claim(deliveryID)
+		if !ok && d.ID != "" {
+			log.Printf("github: skipping duplicate delivery %s, published to %s at offset %d\n", d.ID, d.Topic, d.Offset)
+			return nil
+		} else if !ok {
+			// the delivery isn't confirmed, until the other copy is published, so the copy must be redelivered
+			return StatusError(http.StatusConflict, "delivery is being published", nil)
+		}
+	}
+
+	headers := stream.Headers{
+		hooks.HeaderEvent: event,
+	}
+	if meta.Action != "" {
+		headers[hooks.HeaderAction] = meta.Action
+	}
+	if deliveryID != "" {
+		headers[hooks.HeaderDelivery] = deliveryID
+	}
+	if meta.Repository.FullName != "" {
+		headers[hooks.HeaderRepository] = meta.Repository.FullName
+	}
+	if meta.Installation != nil {
+		headers[hooks.HeaderInstallation] = strconv.FormatInt(meta.Installation.ID, 10)
+	}
+	if h.tenant != "" {
+		headers[hooks.HeaderTenant] = h.tenant
+	}
+
+	offset, err := h.stream.Publish(r.Context(), topic, body, headers)
+	if err != nil {
+		if deliveryID != "" {
+			h.deliveries.Release(deliveryID)
+		}
 		return err
 	}
 
-	if err := json.Unmarshal(body, v); err != nil {
-		return xerrors.Errorf("could not decode event payload %s: %w", body, err)
+	if deliveryID != "" {
+		err := h.deliveries.Add(Delivery{
+			ID:         deliveryID,
+			Topic:      topic,
+			Offset:     offset,
+			ReceivedAt: time.Now(),
+		})
+		if err != nil {
+			// the event is published already, so GitHub must not redeliver it
+			log.Printf("github: failed to record delivery %s: %v\n", deliveryID, err)
+		}
 	}
+
 	return nil
 }
 
-func verifyRequest(secret, sig string, body []byte) error {
-	if secret != "" && sig == "" {
-		return ErrNoSignature
+// Delivery returns the delivery by id, if it was published within the deduplication window.
+func (h *GithubHandler) Delivery(id string) (Delivery, bool) {
+	return h.deliveries.Get(id)
+}
+
+// validateIssuesEvent checks that the payload is an issues event. Events of every action are published,
+// even of the actions GitHub adds later; processors ignore the actions they don't handle.
+func validateIssuesEvent(payload []byte) error {
+	event := &IssuesEventPayload{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return StatusError(http.StatusBadRequest, "bad event", err)
 	}
+	return nil
+}
 
-	hash := hmac.New(sha1.New, []byte(secret))
-	hash.Write(body)
+// isValidEventName reports whether the event is safe to use in topic's name.
+// GitHub event types are made of lowercase letters and underscores, e.g. "pull_request".
+func isValidEventName(event string) bool {
+	if event == "" {
+		return false
+	}
+	for _, c := range event {
+		if (c < 'a' || c > 'z') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
 
-	sig1 := hash.Sum([]byte(nil))
-	sig2, err := hex.DecodeString(strings.TrimPrefix(sig, "sha1="))
+// readRequest verifies request's signature and decodes its body into v. It returns the raw body.
+func readRequest(r *http.Request, verifier *SignatureVerifier, v interface{}) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := verifier.Verify(r.Header, body); err != nil {
+		return nil, err
 	}
-	if !hmac.Equal(sig1, sig2) {
-		return xerrors.Errorf("bad signature %s", sig)
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, xerrors.Errorf("could not decode event payload %s: %w", body, err)
 	}
-	return nil
+	return body, nil
 }
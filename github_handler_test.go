@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adjust/hookeye/hooks"
+	"github.com/adjust/hookeye/stream"
+)
+
+const testGithubSecret = "secret"
+
+// githubHandlerTest serves GithubHandler of the tenant, and collects the messages published to issues
+// and pull requests topics.
+type githubHandlerTest struct {
+	stream       *stream.Stream
+	handler      *GithubHandler
+	srv          *httptest.Server
+	issues       chan *stream.Message
+	pullRequests chan *stream.Message
+}
+
+func newGithubHandlerTest(t *testing.T, tenant string) *githubHandlerTest {
+	t.Helper()
+
+	s := stream.New()
+	ht := &githubHandlerTest{
+		stream:       s,
+		issues:       make(chan *stream.Message, 10),
+		pullRequests: make(chan *stream.Message, 10),
+	}
+	collect := func(c chan *stream.Message) stream.Processor {
+		return stream.ProcessorFunc(func(ctx context.Context, msg *stream.Message) error {
+			c <- msg
+			return nil
+		})
+	}
+	if err := s.SubscribeN(githubIssuesTopic, issuesProcessorGroup, collect(ht.issues), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SubscribeN(githubPullRequestsTopic, pullRequestsProcessorGroup, collect(ht.pullRequests), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := OpenDeliveryLog("", time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ht.handler = NewGithubHandler(tenant, s, &SignatureVerifier{Secrets: []string{testGithubSecret}}, deliveries)
+	mux := http.NewServeMux()
+	ht.handler.RegisterRoutes(mux)
+	ht.srv = httptest.NewServer(mux)
+
+	return ht
+}
+
+func (ht *githubHandlerTest) Close() {
+	ht.srv.Close()
+	ht.stream.Stop()
+}
+
+// post sends the signed delivery of the event to the path and returns the status of the response.
+func (ht *githubHandlerTest) post(t *testing.T, path, event, delivery, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ht.srv.URL+path, bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", delivery)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+sign(sha256.New, testGithubSecret, []byte(body)))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func receive(t *testing.T, c chan *stream.Message) *stream.Message {
+	t.Helper()
+
+	select {
+	case msg := <-c:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message published")
+		return nil
+	}
+}
+
+func TestGithubHandler_Issues(t *testing.T) {
+	ht := newGithubHandlerTest(t, "")
+	defer ht.Close()
+
+	body := `{"action": "closed", "issue": {"number": 1}, "repository": {"name": "hookeye", "full_name": "adjust/hookeye"}}`
+	if status := ht.post(t, "/github", "issues", "d1", body); status != http.StatusOK {
+		t.Fatalf("closed issue: want status 200, got %d", status)
+	}
+
+	msg := receive(t, ht.issues)
+	if string(msg.Data) != body {
+		t.Errorf("want the whole payload published, got %s", msg.Data)
+	}
+	want := stream.Headers{
+		hooks.HeaderEvent:      "issues",
+		hooks.HeaderAction:     "closed",
+		hooks.HeaderDelivery:   "d1",
+		hooks.HeaderRepository: "adjust/hookeye",
+	}
+	if !reflect.DeepEqual(msg.Headers, want) {
+		t.Errorf("want headers %v, got %v", want, msg.Headers)
+	}
+
+	// the redelivery is accepted, but isn't published again
+	if status := ht.post(t, "/github", "issues", "d1", body); status != http.StatusOK {
+		t.Errorf("redelivery: want status 200, got %d", status)
+	}
+
+	// actions, GitHub adds later, are published too
+	body = `{"action": "exploded", "issue": {"number": 1}}`
+	if status := ht.post(t, "/github", "issues", "d2", body); status != http.StatusOK {
+		t.Errorf("unknown action: want status 200, got %d", status)
+	}
+	if msg := receive(t, ht.issues); msg.Headers.Get(hooks.HeaderAction) != "exploded" {
+		t.Errorf("want exploded action, got %v", msg.Headers)
+	}
+
+	if status := ht.post(t, "/github", "issues", "d3", `{"action": 1}`); status != http.StatusBadRequest {
+		t.Errorf("bad payload: want status 400, got %d", status)
+	}
+
+	if stats := ht.stream.Topic(githubIssuesTopic).Stats(); stats.TailOffset != 2 {
+		t.Errorf("want 2 messages published, got tail offset %d", stats.TailOffset)
+	}
+}
+
+func TestGithubHandler_Events(t *testing.T) {
+	ht := newGithubHandlerTest(t, "")
+	defer ht.Close()
+
+	body := `{"action": "opened", "number": 2, "pull_request": {"number": 2}}`
+	if status := ht.post(t, "/github", "pull_request", "d1", body); status != http.StatusOK {
+		t.Fatalf("pull request: want status 200, got %d", status)
+	}
+	if msg := receive(t, ht.pullRequests); msg.Headers.Get(hooks.HeaderEvent) != "pull_request" {
+		t.Errorf("want pull_request event in %s, got %v", githubPullRequestsTopic, msg.Headers)
+	}
+
+	// events, no hook subscribes to, aren't stored
+	if status := ht.post(t, "/github", "push", "d2", `{"ref": "refs/heads/master"}`); status != http.StatusOK {
+		t.Errorf("push: want status 200, got %d", status)
+	}
+	if ht.stream.Topic(GithubTopic("push")) != nil {
+		t.Errorf("want no topic for push events")
+	}
+
+	for _, event := range []string{"", "Pull-Request", "../issues"} {
+		if status := ht.post(t, "/github", event, "d3", `{}`); status != http.StatusBadRequest {
+			t.Errorf("event %q: want status 400, got %d", event, status)
+		}
+	}
+}
+
+func TestGithubHandler_Ping(t *testing.T) {
+	ht := newGithubHandlerTest(t, "")
+	defer ht.Close()
+
+	body := `{"zen": "Keep it logically awesome.", "hook_id": 42, "hook": {"id": 42, "events": ["issues", "push"], "config": {"content_type": "json"}}, "repository": {"name": "hookeye"}}`
+
+	// pings are signature-checked too
+	req, err := http.NewRequest(http.MethodPost, ht.srv.URL+"/github", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-GitHub-Event", "ping")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unsigned ping: want status 400, got %d", resp.StatusCode)
+	}
+	if hooks := ht.handler.Hooks(); len(hooks) != 0 {
+		t.Errorf("unsigned ping: want no hooks, got %+v", hooks)
+	}
+
+	if status := ht.post(t, "/github", "ping", "d1", body); status != http.StatusOK {
+		t.Fatalf("ping: want status 200, got %d", status)
+	}
+
+	hooks := ht.handler.Hooks()
+	if len(hooks) != 1 {
+		t.Fatalf("want 1 hook, got %+v", hooks)
+	}
+	hook := hooks[0]
+	if hook.ID != 42 || hook.Repository != "hookeye" || hook.Config["content_type"] != "json" {
+		t.Errorf("want hook 42 of hookeye, got %+v", hook)
+	}
+	if want := []string{"push"}; !reflect.DeepEqual(hook.UnconsumedEvents, want) {
+		t.Errorf("want unconsumed events %v, got %v", want, hook.UnconsumedEvents)
+	}
+}
+
+func TestGithubHandler_Tenant(t *testing.T) {
+	ht := newGithubHandlerTest(t, "adjust")
+	defer ht.Close()
+
+	body := `{"action": "opened", "issue": {"number": 1}, "installation": {"id": 7}}`
+	if status := ht.post(t, "/github", "issues", "d1", body); status != http.StatusNotFound {
+		t.Errorf("default route: want status 404, got %d", status)
+	}
+	if status := ht.post(t, "/github/adjust", "issues", "d1", body); status != http.StatusOK {
+		t.Fatalf("tenant's route: want status 200, got %d", status)
+	}
+	msg := receive(t, ht.issues)
+	if msg.Headers.Get(hooks.HeaderTenant) != "adjust" || msg.Headers.Get(hooks.HeaderInstallation) != "7" {
+		t.Errorf("want tenant and installation headers, got %v", msg.Headers)
+	}
+
+	// app's installations share the tenant
+	body = `{"action": "opened", "issue": {"number": 1}, "installation": {"id": 8}}`
+	if status := ht.post(t, "/github/adjust", "issues", "d2", body); status != http.StatusOK {
+		t.Fatalf("another installation: want status 200, got %d", status)
+	}
+	if msg := receive(t, ht.issues); msg.Headers.Get(hooks.HeaderInstallation) != "8" {
+		t.Errorf("want installation 8, got %v", msg.Headers)
+	}
+}
@@ -3,9 +3,6 @@ module github.com/adjust/hookeye
 go 1.12
 
 require (
-	github.com/machinebox/graphql v0.2.2
-	github.com/matryer/is v1.2.0 // indirect
 	github.com/peterbourgon/ff v1.2.0
-	github.com/pkg/errors v0.8.1 // indirect
-	golang.org/x/xerrors v0.0.0-20190410155217-1f06c39b4373
+	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da
 )
@@ -0,0 +1,246 @@
+package githubsvc
+
+import (
+	"container/list"
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	// cacheHits counts lookups, that were served from the cache, by the kind of the lookup
+	cacheHits = expvar.NewMap("github_cache_hits")
+	// cacheMisses counts lookups, that were sent to GitHub, by the kind of the lookup
+	cacheMisses = expvar.NewMap("github_cache_misses")
+)
+
+// Kinds of the cached lookups, used as the prefixes of cache keys and as the keys of cache metrics.
+const (
+	cacheProject   = "project"
+	cacheProjectV2 = "project_v2"
+	cacheColumn    = "column"
+)
+
+// Cache is a TTL + LRU cache of lookups, e.g. of project ids by project paths, that practically never change.
+// Failed lookups of missing objects are cached too, for a shorter time, so a rule, that refers to a deleted project,
+// doesn't make a request to GitHub for every event. It's safe for concurrent use.
+type Cache struct {
+	// Size is the max number of entries; the least recently used entry is evicted, when the cache is full.
+	Size int
+	// TTL is the time, a found object is cached for.
+	TTL time.Duration
+	// NegativeTTL is the time, a missing object is cached for.
+	NegativeTTL time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List // of *cacheEntry, the most recently used at front
+	items map[string]*list.Element
+	// projectIDs are the ids of classic projects by path, that were looked up. Unlike the entries, they aren't
+	// expired or evicted, so the columns of a project are found by its path, after project's entry is gone.
+	projectIDs map[string]string
+}
+
+type cacheEntry struct {
+	key       string
+	value     interface{}
+	err       error
+	expiresAt time.Time
+}
+
+// CacheStats is the state of the cache.
+type CacheStats struct {
+	Len         int           `json:"len"`
+	Size        int           `json:"size"`
+	TTL         time.Duration `json:"ttl"`
+	NegativeTTL time.Duration `json:"negative_ttl"`
+}
+
+func NewCache(size int, ttl, negativeTTL time.Duration) *Cache {
+	return &Cache{
+		Size:        size,
+		TTL:         ttl,
+		NegativeTTL: negativeTTL,
+		ll:          list.New(),
+		items:       make(map[string]*list.Element),
+		projectIDs:  make(map[string]string),
+	}
+}
+
+// get returns the value or the error of the lookup, if the key is in the cache and isn't expired.
+func (c *Cache) get(key string) (value interface{}, ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(el)
+		return nil, false, nil
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, true, entry.err
+}
+
+// add puts the value of the lookup into the cache; if err isn't nil, it's cached as a missing object.
+func (c *Cache) add(key string, value interface{}, err error) {
+	ttl := c.TTL
+	if err != nil {
+		ttl = c.NegativeTTL
+	}
+	if ttl <= 0 || c.Size <= 0 {
+		return
+	}
+	entry := &cacheEntry{
+		key:       key,
+		value:     value,
+		err:       err,
+		expiresAt: time.Now().Add(ttl),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value = entry
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(entry)
+	for c.ll.Len() > c.Size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove removes the entry with the key and reports whether it was in the cache.
+func (c *Cache) Remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if ok {
+		c.removeElement(el)
+	}
+	return ok
+}
+
+// RemovePrefix removes all entries with the keys, starting with the prefix, and returns the number of removed entries.
+func (c *Cache) RemovePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElement(el)
+			n++
+		}
+	}
+	return n
+}
+
+// Purge removes all entries.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.projectIDs = make(map[string]string)
+}
+
+// setProjectID remembers the id of the classic project with the path.
+func (c *Cache) setProjectID(path, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.projectIDs[path] = id
+}
+
+// removeProjectID forgets the id of the classic project with the path, and returns the id, if it was known.
+func (c *Cache) removeProjectID(path string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, ok := c.projectIDs[path]
+	delete(c.projectIDs, path)
+	return id, ok
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Len:         c.ll.Len(),
+		Size:        c.Size,
+		TTL:         c.TTL,
+		NegativeTTL: c.NegativeTTL,
+	}
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).key)
+}
+
+// cacheKey joins the kind of the lookup with its arguments.
+func cacheKey(kind string, args ...string) string {
+	return kind + ":" + strings.Join(args, ":")
+}
+
+// isNotFound reports whether the lookup failed, because the object doesn't exist.
+func isNotFound(err error) bool {
+	return xerrors.Is(err, ErrProjectNotFound) || xerrors.Is(err, ErrColumnNotFound)
+}
+
+// cached returns the result of the lookup from the cache, or runs fetch and caches its result. Only errors,
+// that report missing objects (see isNotFound), are cached. If the service has no cache, fetch is always run.
+func (svc *Service) cached(kind, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	if svc.Cache == nil {
+		return fetch()
+	}
+
+	if value, ok, err := svc.Cache.get(key); ok {
+		cacheHits.Add(kind, 1)
+		return value, err
+	}
+	cacheMisses.Add(kind, 1)
+
+	value, err := fetch()
+	if err == nil {
+		svc.Cache.add(key, value, nil)
+	} else if isNotFound(err) {
+		svc.Cache.add(key, nil, err)
+	}
+	return value, err
+}
+
+// InvalidateProject removes cached lookups of the project and its columns, e.g. after the project was recreated.
+// If path is empty, the whole cache is purged.
+func (svc *Service) InvalidateProject(path string) int {
+	if svc.Cache == nil {
+		return 0
+	}
+	if path == "" {
+		n := svc.Cache.Stats().Len
+		svc.Cache.Purge()
+		return n
+	}
+
+	var n int
+	if id, ok := svc.Cache.removeProjectID(path); ok {
+		n += svc.Cache.RemovePrefix(cacheKey(cacheColumn, id, ""))
+	}
+	for _, key := range []string{cacheKey(cacheProject, path), cacheKey(cacheProjectV2, path)} {
+		if svc.Cache.Remove(key) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,158 @@
+package githubsvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adjust/hookeye/github"
+	"golang.org/x/xerrors"
+)
+
+func TestCache(t *testing.T) {
+	cache := NewCache(2, time.Hour, time.Millisecond)
+
+	cache.add("a", 1, nil)
+	cache.add("b", 2, nil)
+	// "a" is used, so "b" is the least recently used one
+	if v, ok, _ := cache.get("a"); !ok || v != 1 {
+		t.Fatalf("a: want 1, got %v (%v)", v, ok)
+	}
+	cache.add("c", 3, nil)
+	if _, ok, _ := cache.get("b"); ok {
+		t.Errorf("b: want evicted")
+	}
+	if v, ok, _ := cache.get("c"); !ok || v != 3 {
+		t.Errorf("c: want 3, got %v (%v)", v, ok)
+	}
+
+	cache.add("d", nil, ErrProjectNotFound)
+	if _, ok, err := cache.get("d"); !ok || err != ErrProjectNotFound {
+		t.Errorf("d: want cached error, got %v (%v)", err, ok)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, ok, _ := cache.get("d"); ok {
+		t.Errorf("d: want expired")
+	}
+
+	cache.Purge()
+	if n := cache.Stats().Len; n != 0 {
+		t.Errorf("want empty cache after purge, got %d entries", n)
+	}
+}
+
+func TestService_FindProjectID_Cache(t *testing.T) {
+	// the project 404 doesn't exist
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		var req struct {
+			Variables struct {
+				Number int `json:"number"`
+			} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if req.Variables.Number == 404 {
+			w.Write([]byte(`{"data": {"organization": {"project": null}}, "errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a Project with the number 404."}]}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"organization": {"project": {"id": "P1", "name": "project"}}}}`))
+	}))
+	defer srv.Close()
+
+	svc := &Service{
+		Client: github.NewClient(srv.URL, "token"),
+		Cache:  NewCache(10, time.Hour, time.Hour),
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		resp, err := svc.FindProjectID(ctx, "/orgs/adjust/projects/13")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ID != "P1" {
+			t.Errorf("want project P1, got %q", resp.ID)
+		}
+
+		_, err = svc.FindProjectID(ctx, "/orgs/adjust/projects/404")
+		if !xerrors.Is(err, ErrProjectNotFound) {
+			t.Errorf("want ErrProjectNotFound, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("want 2 requests to GitHub, got %d", n)
+	}
+
+	if n := svc.InvalidateProject("/orgs/adjust/projects/13"); n != 1 {
+		t.Errorf("invalidate: want 1 removed entry, got %d", n)
+	}
+	if _, err := svc.FindProjectID(ctx, "/orgs/adjust/projects/13"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("want project to be requested after invalidation, got %d requests", n)
+	}
+}
+
+func TestService_InvalidateProject_EvictedProject(t *testing.T) {
+	var columnRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string `json:"query"`
+			Variables struct {
+				Number int `json:"number"`
+			} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(req.Query, "query ProjectColumns") {
+			atomic.AddInt32(&columnRequests, 1)
+			w.Write([]byte(`{"data": {"node": {"columns": {"pageInfo": {"hasNextPage": false}, "nodes": [{"id": "C1", "name": "Todo"}, {"id": "C2", "name": "Done"}]}}}}`))
+			return
+		}
+		fmt.Fprintf(w, `{"data": {"organization": {"project": {"id": "P%d", "name": "project"}}}}`, req.Variables.Number)
+	}))
+	defer srv.Close()
+
+	svc := &Service{
+		Client: github.NewClient(srv.URL, "token"),
+		Cache:  NewCache(3, time.Hour, time.Hour),
+	}
+	ctx := context.Background()
+
+	proj, err := svc.FindProjectID(ctx, "/orgs/adjust/projects/13")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ProjectColumnID(ctx, string(proj.ID), "Todo"); err != nil {
+		t.Fatal(err)
+	}
+	// the entry of project 13 is the least recently used one, so it's evicted, but its columns stay
+	if _, err := svc.FindProjectID(ctx, "/orgs/adjust/projects/14"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := svc.Cache.get(cacheKey(cacheProject, "/orgs/adjust/projects/13")); ok {
+		t.Fatalf("want project 13 evicted")
+	}
+
+	if n := svc.InvalidateProject("/orgs/adjust/projects/13"); n != 2 {
+		t.Errorf("invalidate: want 2 removed columns, got %d", n)
+	}
+	if _, err := svc.ProjectColumnID(ctx, string(proj.ID), "Done"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&columnRequests); n != 2 {
+		t.Errorf("want columns to be requested after invalidation, got %d requests", n)
+	}
+}
@@ -0,0 +1,48 @@
+package githubsvc
+
+import (
+	"context"
+
+	"github.com/adjust/hookeye/github"
+	"golang.org/x/xerrors"
+)
+
+// pageSize is the number of nodes requested per page of a connection; 100 is the max GitHub allows.
+const pageSize = 100
+
+// maxPages limits the number of pages fetched from a connection, so a misbehaving API can't loop forever.
+const maxPages = 100
+
+// PageInfo is the pagination info of a GraphQL connection.
+type PageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// paginate runs the query with vars for every page of a connection, until the connection has no next page.
+// The query must take $first and $after variables and pass them to the connection. fetch runs the request
+// for a single page, collects page's nodes and returns connection's page info.
+func (svc *Service) paginate(ctx context.Context, query string, vars map[string]interface{}, fetch func(req *github.Request) (PageInfo, error)) error {
+	var after interface{}
+	for page := 0; page < maxPages; page++ {
+		req := github.NewRequest(query)
+		for k, v := range vars {
+			req.Var(k, v)
+		}
+		req.Var("first", pageSize)
+		req.Var("after", after)
+
+		info, err := fetch(req)
+		if err != nil {
+			return err
+		}
+		if !info.HasNextPage {
+			return nil
+		}
+		if info.EndCursor == "" || info.EndCursor == after {
+			return xerrors.Errorf("bad cursor %q of page %d", info.EndCursor, page)
+		}
+		after = info.EndCursor
+	}
+	return xerrors.Errorf("connection has more than %d pages", maxPages)
+}
@@ -0,0 +1,283 @@
+package githubsvc
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/adjust/hookeye/github"
+	"golang.org/x/xerrors"
+)
+
+const (
+	fragmentProjectV2 = `
+		fragment ProjectV2Fields on ProjectV2 {
+			id
+			title
+			fields(first: $first, after: $after) {
+				pageInfo {
+					hasNextPage
+					endCursor
+				}
+				nodes {
+					... on ProjectV2FieldCommon {
+						id
+						name
+						dataType
+					}
+					... on ProjectV2SingleSelectField {
+						options {
+							id
+							name
+						}
+					}
+					... on ProjectV2IterationField {
+						configuration {
+							iterations {
+								id
+								title
+								startDate
+							}
+						}
+					}
+				}
+			}
+		}`
+
+	queryFindOrgProjectV2 = `
+		query FindOrgProjectV2 ($login: String!, $number: Int!, $first: Int!, $after: String) {
+			rateLimit {
+				cost
+				remaining
+				resetAt
+			}
+			organization(login: $login) {
+				projectV2(number: $number) {
+					...ProjectV2Fields
+				}
+			}
+		}` + fragmentProjectV2
+
+	queryFindUserProjectV2 = `
+		query FindUserProjectV2 ($login: String!, $number: Int!, $first: Int!, $after: String) {
+			rateLimit {
+				cost
+				remaining
+				resetAt
+			}
+			user(login: $login) {
+				projectV2(number: $number) {
+					...ProjectV2Fields
+				}
+			}
+		}` + fragmentProjectV2
+
+	mutationAddProjectV2Item = `
+		mutation AddProjectV2Item ($projectId: ID!, $contentId: ID!) {
+			addProjectV2ItemById(input: {projectId: $projectId, contentId: $contentId}) {
+				item {
+					id
+				}
+			}
+		}`
+
+	mutationUpdateProjectV2ItemFieldValue = `
+		mutation UpdateProjectV2ItemFieldValue ($projectId: ID!, $itemId: ID!, $fieldId: ID!, $value: ProjectV2FieldValue!) {
+			updateProjectV2ItemFieldValue(input: {projectId: $projectId, itemId: $itemId, fieldId: $fieldId, value: $value}) {
+				projectV2Item {
+					id
+				}
+			}
+		}`
+)
+
+// Data types of ProjectV2 fields, that values can be set for.
+const (
+	ProjectV2FieldText         = "TEXT"
+	ProjectV2FieldNumber       = "NUMBER"
+	ProjectV2FieldDate         = "DATE"
+	ProjectV2FieldSingleSelect = "SINGLE_SELECT"
+	ProjectV2FieldIteration    = "ITERATION"
+)
+
+// ProjectV2 is a GitHub project (the new "Projects" experience), with its fields.
+type ProjectV2 struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Fields struct {
+		PageInfo PageInfo         `json:"pageInfo"`
+		Nodes    []ProjectV2Field `json:"nodes"`
+	} `json:"fields"`
+}
+
+// Field returns project's field by name.
+func (proj *ProjectV2) Field(name string) (*ProjectV2Field, bool) {
+	for i := range proj.Fields.Nodes {
+		if proj.Fields.Nodes[i].Name == name {
+			return &proj.Fields.Nodes[i], true
+		}
+	}
+	return nil, false
+}
+
+type ProjectV2Field struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	DataType string `json:"dataType"`
+	// Options of single select field
+	Options []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"options,omitempty"`
+	// Configuration of iteration field
+	Configuration struct {
+		Iterations []struct {
+			ID        string `json:"id"`
+			Title     string `json:"title"`
+			StartDate string `json:"startDate"`
+		} `json:"iterations"`
+	} `json:"configuration"`
+}
+
+// ProjectV2FieldValue is a value of ProjectV2 item's field. Only one of the values is set.
+type ProjectV2FieldValue struct {
+	Text                 *string  `json:"text,omitempty"`
+	Number               *float64 `json:"number,omitempty"`
+	Date                 *string  `json:"date,omitempty"`
+	SingleSelectOptionID *string  `json:"singleSelectOptionId,omitempty"`
+	IterationID          *string  `json:"iterationId,omitempty"`
+}
+
+// Value converts the value, as it's written in the rules, to the value of the field's type:
+// the name of single select's option, the title of the iteration, a number, a date as "2006-01-02" or a text.
+func (f *ProjectV2Field) Value(s string) (ProjectV2FieldValue, error) {
+	switch f.DataType {
+	case ProjectV2FieldText:
+		return ProjectV2FieldValue{Text: &s}, nil
+	case ProjectV2FieldNumber:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return ProjectV2FieldValue{}, xerrors.Errorf("field %q: bad number %q: %w", f.Name, s, err)
+		}
+		return ProjectV2FieldValue{Number: &n}, nil
+	case ProjectV2FieldDate:
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return ProjectV2FieldValue{}, xerrors.Errorf("field %q: bad date %q: %w", f.Name, s, err)
+		}
+		return ProjectV2FieldValue{Date: &s}, nil
+	case ProjectV2FieldSingleSelect:
+		for _, opt := range f.Options {
+			if opt.Name == s {
+				id := opt.ID
+				return ProjectV2FieldValue{SingleSelectOptionID: &id}, nil
+			}
+		}
+		return ProjectV2FieldValue{}, xerrors.Errorf("field %q has no option %q", f.Name, s)
+	case ProjectV2FieldIteration:
+		for _, it := range f.Configuration.Iterations {
+			if it.Title == s {
+				id := it.ID
+				return ProjectV2FieldValue{IterationID: &id}, nil
+			}
+		}
+		return ProjectV2FieldValue{}, xerrors.Errorf("field %q has no iteration %q", f.Name, s)
+	default:
+		return ProjectV2FieldValue{}, xerrors.Errorf("field %q of type %s can't be set", f.Name, f.DataType)
+	}
+}
+
+// FindProjectV2 returns the project of an organization ("/orgs/<login>/projects/<number>")
+// or of a user ("/users/<login>/projects/<number>") with its fields. It returns ErrProjectNotFound,
+// if the project doesn't exist. The returned project may be shared with other callers and must not be modified.
+func (svc *Service) FindProjectV2(ctx context.Context, projectPath string) (*ProjectV2, error) {
+	value, err := svc.cached(cacheProjectV2, cacheKey(cacheProjectV2, projectPath), func() (interface{}, error) {
+		return svc.findProjectV2(ctx, projectPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*ProjectV2), nil
+}
+
+func (svc *Service) findProjectV2(ctx context.Context, projectPath string) (*ProjectV2, error) {
+	path, err := ParseProjectPath(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	if path.Repository != "" {
+		return nil, xerrors.Errorf("project %q: repositories have no ProjectV2", projectPath)
+	}
+
+	query := queryFindOrgProjectV2
+	if path.User {
+		query = queryFindUserProjectV2
+	}
+	vars := map[string]interface{}{
+		"login":  path.Owner,
+		"number": path.Number,
+	}
+
+	var proj *ProjectV2
+	err = svc.paginate(ctx, query, vars, func(req *github.Request) (PageInfo, error) {
+		resp := struct {
+			Organization struct {
+				ProjectV2 *ProjectV2 `json:"projectV2"`
+			} `json:"organization"`
+			User struct {
+				ProjectV2 *ProjectV2 `json:"projectV2"`
+			} `json:"user"`
+		}{}
+		if err := svc.Client.Run(ctx, req, &resp); err != nil {
+			return PageInfo{}, projectError(projectPath, err)
+		}
+
+		page := resp.Organization.ProjectV2
+		if path.User {
+			page = resp.User.ProjectV2
+		}
+		if page == nil || page.ID == "" {
+			return PageInfo{}, xerrors.Errorf("project %q: %w", projectPath, ErrProjectNotFound)
+		}
+		if proj == nil {
+			proj = page
+		} else {
+			proj.Fields.Nodes = append(proj.Fields.Nodes, page.Fields.Nodes...)
+		}
+		return page.Fields.PageInfo, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proj, nil
+}
+
+// AddProjectV2Item adds the content, i.e. an issue or a pull request, to the project, and returns the id of the item.
+// If the content is already in the project, the existing item is returned.
+func (svc *Service) AddProjectV2Item(ctx context.Context, projectID, contentID string) (string, error) {
+	req := github.NewRequest(mutationAddProjectV2Item)
+	req.Var("projectId", projectID)
+	req.Var("contentId", contentID)
+
+	resp := struct {
+		AddProjectV2ItemByID struct {
+			Item struct {
+				ID string `json:"id"`
+			} `json:"item"`
+		} `json:"addProjectV2ItemById"`
+	}{}
+	if err := svc.Client.Run(ctx, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.AddProjectV2ItemByID.Item.ID, nil
+}
+
+// SetProjectV2ItemFieldValue sets the value of item's field.
+func (svc *Service) SetProjectV2ItemFieldValue(ctx context.Context, projectID, itemID, fieldID string, value ProjectV2FieldValue) error {
+	req := github.NewRequest(mutationUpdateProjectV2ItemFieldValue)
+	req.Var("projectId", projectID)
+	req.Var("itemId", itemID)
+	req.Var("fieldId", fieldID)
+	req.Var("value", value)
+
+	return svc.Client.Run(ctx, req, nil)
+}
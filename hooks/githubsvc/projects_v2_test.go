@@ -0,0 +1,280 @@
+package githubsvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adjust/hookeye/github"
+	"golang.org/x/xerrors"
+)
+
+func TestProjectV2Field_Value(t *testing.T) {
+	var proj ProjectV2
+	err := json.Unmarshal([]byte(`{
+		"id": "PVT_1",
+		"fields": {"nodes": [
+			{"id": "F1", "name": "Title", "dataType": "TEXT"},
+			{"id": "F2", "name": "Estimate", "dataType": "NUMBER"},
+			{"id": "F3", "name": "Due", "dataType": "DATE"},
+			{"id": "F4", "name": "Status", "dataType": "SINGLE_SELECT", "options": [{"id": "O1", "name": "Triage"}]},
+			{"id": "F5", "name": "Sprint", "dataType": "ITERATION", "configuration": {"iterations": [{"id": "I1", "title": "Sprint 1"}]}},
+			{"id": "F6", "name": "Assignees", "dataType": "ASSIGNEES"}
+		]}
+	}`), &proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		field, value string
+		want         string
+	}{
+		{"Title", "text", `{"text":"text"}`},
+		{"Estimate", "0", `{"number":0}`},
+		{"Estimate", "x", ``},
+		{"Due", "2020-01-02", `{"date":"2020-01-02"}`},
+		{"Due", "tomorrow", ``},
+		{"Status", "Triage", `{"singleSelectOptionId":"O1"}`},
+		{"Status", "Done", ``},
+		{"Sprint", "Sprint 1", `{"iterationId":"I1"}`},
+		{"Sprint", "Sprint 2", ``},
+		{"Assignees", "narqo", ``},
+	}
+	for _, tc := range cases {
+		field, ok := proj.Field(tc.field)
+		if !ok {
+			t.Fatalf("no field %q", tc.field)
+		}
+		value, err := field.Value(tc.value)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s=%s: want error", tc.field, tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s=%s: %v", tc.field, tc.value, err)
+			continue
+		}
+		if got, _ := json.Marshal(value); string(got) != tc.want {
+			t.Errorf("%s=%s: want %s, got %s", tc.field, tc.value, tc.want, got)
+		}
+	}
+}
+
+// fakeProjectsV2 is a fake GitHub GraphQL API, that keeps ProjectV2 number 1 of adjust organisation
+// and of narqo user, and records the items and values, added to them.
+type fakeProjectsV2 struct {
+	mu sync.Mutex
+	// fields are the fields of the projects
+	fields []map[string]interface{}
+	// pageSize is the max number of fields in a page; all fields are returned in one page if it's 0
+	pageSize int
+	// queries are the names of the queries, the projects were requested with
+	queries []string
+	// cursors, the pages of fields were requested after
+	cursors []string
+
+	// items are the contents, added to the projects, by project's id
+	items map[string][]string
+	// values are the values, set to items' fields, by item's and field's id
+	values map[string]string
+}
+
+func (f *fakeProjectsV2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query     string `json:"query"`
+		Variables struct {
+			Login     string          `json:"login"`
+			Number    int             `json:"number"`
+			After     *string         `json:"after"`
+			ProjectID string          `json:"projectId"`
+			ContentID string          `json:"contentId"`
+			ItemID    string          `json:"itemId"`
+			FieldID   string          `json:"fieldId"`
+			Value     json.RawMessage `json:"value"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var data interface{}
+	switch {
+	case strings.Contains(req.Query, "query FindOrgProjectV2"), strings.Contains(req.Query, "query FindUserProjectV2"):
+		owner, login := "organization", "adjust"
+		if strings.Contains(req.Query, "query FindUserProjectV2") {
+			owner, login = "user", "narqo"
+		}
+		f.queries = append(f.queries, owner)
+
+		if req.Variables.Login != login || req.Variables.Number != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"data": {%q: {"projectV2": null}}, "errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a ProjectV2"}]}`, owner)
+			return
+		}
+
+		var after string
+		if req.Variables.After != nil {
+			after = *req.Variables.After
+		}
+		f.cursors = append(f.cursors, after)
+		data = map[string]interface{}{owner: map[string]interface{}{"projectV2": f.project("PVT_"+login, after)}}
+	case strings.Contains(req.Query, "mutation AddProjectV2Item"):
+		f.items[req.Variables.ProjectID] = append(f.items[req.Variables.ProjectID], req.Variables.ContentID)
+		data = map[string]interface{}{"addProjectV2ItemById": map[string]interface{}{"item": map[string]interface{}{"id": "item-" + req.Variables.ContentID}}}
+	case strings.Contains(req.Query, "mutation UpdateProjectV2ItemFieldValue"):
+		f.values[req.Variables.ItemID+"/"+req.Variables.FieldID] = string(req.Variables.Value)
+		data = map[string]interface{}{"updateProjectV2ItemFieldValue": map[string]interface{}{"projectV2Item": map[string]interface{}{"id": req.Variables.ItemID}}}
+	default:
+		http.Error(w, "unexpected query", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// project returns the project with the page of fields, that follows the field with the cursor.
+func (f *fakeProjectsV2) project(id, after string) map[string]interface{} {
+	start := 0
+	for i, field := range f.fields {
+		if "cursor-"+field["id"].(string) == after {
+			start = i + 1
+		}
+	}
+	end := len(f.fields)
+	if f.pageSize > 0 && start+f.pageSize < end {
+		end = start + f.pageSize
+	}
+
+	pageInfo := map[string]interface{}{"hasNextPage": end < len(f.fields)}
+	if end > start {
+		pageInfo["endCursor"] = "cursor-" + f.fields[end-1]["id"].(string)
+	}
+	return map[string]interface{}{
+		"id":    id,
+		"title": "Roadmap",
+		"fields": map[string]interface{}{
+			"pageInfo": pageInfo,
+			"nodes":    f.fields[start:end],
+		},
+	}
+}
+
+func TestService_FindProjectV2(t *testing.T) {
+	fake := &fakeProjectsV2{
+		fields: []map[string]interface{}{
+			{"id": "F1", "name": "Title", "dataType": "TEXT"},
+			{"id": "F2", "name": "Estimate", "dataType": "NUMBER"},
+			{"id": "F3", "name": "Status", "dataType": "SINGLE_SELECT", "options": []map[string]string{{"id": "O1", "name": "Triage"}}},
+			{"id": "F4", "name": "Sprint", "dataType": "ITERATION", "configuration": map[string]interface{}{"iterations": []map[string]string{{"id": "I1", "title": "Sprint 1"}}}},
+			{"id": "F5", "name": "Due", "dataType": "DATE"},
+		},
+		pageSize: 2,
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	svc := &Service{
+		Client: github.NewClient(srv.URL, "token"),
+	}
+
+	cases := []struct {
+		path        string
+		wantID      string
+		wantQueries []string
+		wantErr     error
+	}{
+		{"/orgs/adjust/projects/1", "PVT_adjust", []string{"organization", "organization", "organization"}, nil},
+		{"/users/narqo/projects/1", "PVT_narqo", []string{"user", "user", "user"}, nil},
+		{"/orgs/adjust/projects/2", "", []string{"organization"}, ErrProjectNotFound},
+		// narqo is a user, not an organization
+		{"/orgs/narqo/projects/1", "", []string{"organization"}, ErrProjectNotFound},
+	}
+	for _, tc := range cases {
+		fake.queries, fake.cursors = nil, nil
+
+		proj, err := svc.FindProjectV2(context.Background(), tc.path)
+		if !reflect.DeepEqual(tc.wantQueries, fake.queries) {
+			t.Errorf("%s: want queries %v, got %v", tc.path, tc.wantQueries, fake.queries)
+		}
+		if tc.wantErr != nil {
+			if !xerrors.Is(err, tc.wantErr) {
+				t.Errorf("%s: want error %v, got %v", tc.path, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.path, err)
+			continue
+		}
+
+		if proj.ID != tc.wantID || proj.Title != "Roadmap" {
+			t.Errorf("%s: want project %s, got %+v", tc.path, tc.wantID, proj)
+		}
+		var names []string
+		for _, field := range proj.Fields.Nodes {
+			names = append(names, field.Name)
+		}
+		if want := []string{"Title", "Estimate", "Status", "Sprint", "Due"}; !reflect.DeepEqual(want, names) {
+			t.Errorf("%s: want fields %v, got %v", tc.path, want, names)
+		}
+		if want := []string{"", "cursor-F2", "cursor-F4"}; !reflect.DeepEqual(want, fake.cursors) {
+			t.Errorf("%s: want cursors %v, got %v", tc.path, want, fake.cursors)
+		}
+		if field, ok := proj.Field("Sprint"); !ok || len(field.Configuration.Iterations) != 1 {
+			t.Errorf("%s: want Sprint field with an iteration, got %+v", tc.path, field)
+		}
+	}
+
+	// repositories have no ProjectV2, so GitHub isn't asked
+	fake.queries = nil
+	if _, err := svc.FindProjectV2(context.Background(), "/adjust/backend/projects/1"); err == nil || len(fake.queries) != 0 {
+		t.Errorf("repository project: want error without queries, got %v, %v", err, fake.queries)
+	}
+}
+
+func TestService_AddProjectV2Item(t *testing.T) {
+	fake := &fakeProjectsV2{
+		items:  make(map[string][]string),
+		values: make(map[string]string),
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	svc := &Service{
+		Client: github.NewClient(srv.URL, "token"),
+	}
+
+	itemID, err := svc.AddProjectV2Item(context.Background(), "PVT_adjust", "PR_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if itemID != "item-PR_1" {
+		t.Errorf("want item %q, got %q", "item-PR_1", itemID)
+	}
+	if want := map[string][]string{"PVT_adjust": {"PR_1"}}; !reflect.DeepEqual(want, fake.items) {
+		t.Errorf("want items %v, got %v", want, fake.items)
+	}
+
+	option := "O1"
+	err = svc.SetProjectV2ItemFieldValue(context.Background(), "PVT_adjust", itemID, "F3", ProjectV2FieldValue{SingleSelectOptionID: &option})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"item-PR_1/F3": `{"singleSelectOptionId":"O1"}`}; !reflect.DeepEqual(want, fake.values) {
+		t.Errorf("want values %v, got %v", want, fake.values)
+	}
+}
@@ -2,17 +2,22 @@ package githubsvc
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/adjust/hookeye/github"
-	"github.com/machinebox/graphql"
 	"golang.org/x/xerrors"
 )
 
 const (
 	queryIssueProjectCards = `
-		query IssueProjectCards ($id: ID!) {
+		query IssueProjectCards ($id: ID!, $first: Int!, $after: String) {
+			rateLimit {
+				cost
+				remaining
+				resetAt
+			}
 			node(id: $id) {
 				... on Issue {
 					repository {
@@ -20,7 +25,11 @@ const (
 						name
 						nameWithOwner
 					}
-					projectCards {
+					projectCards(first: $first, after: $after) {
+						pageInfo {
+							hasNextPage
+							endCursor
+						}
 						nodes {
 							id
 							url
@@ -36,33 +45,69 @@ const (
 			}
 		}`
 
-	mutationAddIssueProjectCard = `
-		mutation AddIssueProjectCard ($id: ID!, $projectId: ID!) {
-			updateIssue(input: {id: $id, projectIds: [$projectId]}) {
+	mutationAddIssueProjectCards = `
+		mutation AddIssueProjectCards ($id: ID!, $projectIds: [ID!]) {
+			updateIssue(input: {id: $id, projectIds: $projectIds}) {
 				issue {
-					repository {
-						id
-						name
-						nameWithOwner
-					}
-					projectCards {
+					id
+				}
+			}
+		}`
+
+	queryProjectColumns = `
+		query ProjectColumns ($id: ID!, $first: Int!, $after: String) {
+			rateLimit {
+				cost
+				remaining
+				resetAt
+			}
+			node(id: $id) {
+				... on Project {
+					columns(first: $first, after: $after) {
+						pageInfo {
+							hasNextPage
+							endCursor
+						}
 						nodes {
 							id
-							url
-							project {
-								id
-								name
-								url
-								resourcePath
-							}
+							name
 						}
 					}
 				}
 			}
 		}`
 
+	mutationAddProjectCard = `
+		mutation AddProjectCard ($columnId: ID!, $contentId: ID!) {
+			addProjectCard(input: {projectColumnId: $columnId, contentId: $contentId}) {
+				cardEdge {
+					node {
+						id
+						url
+					}
+				}
+			}
+		}`
+
+	mutationMoveProjectCard = `
+		mutation MoveProjectCard ($cardId: ID!, $columnId: ID!) {
+			moveProjectCard(input: {cardId: $cardId, columnId: $columnId}) {
+				cardEdge {
+					node {
+						id
+						url
+					}
+				}
+			}
+		}`
+
 	queryFindOrdProjectID = `
 		query FindProjectID ($login: String!, $number: Int!) {
+			rateLimit {
+				cost
+				remaining
+				resetAt
+			}
 			organization(login: $login) {
 				project(number: $number) {
 					id
@@ -73,6 +118,11 @@ const (
 
 	queryFindRepoProjectID = `
 		query FindProjectID ($owner: String!, $name: String!, $number: Int!) {
+			rateLimit {
+				cost
+				remaining
+				resetAt
+			}
 			repository(owner: $owner, name: $name) {
 				project(number: $number) {
 					id
@@ -82,8 +132,28 @@ const (
 		}`
 )
 
+var (
+	// ErrProjectNotFound is returned when the project with the path doesn't exist.
+	ErrProjectNotFound error = notFoundError("project not found")
+	// ErrColumnNotFound is returned when the project has no column with the name.
+	ErrColumnNotFound error = notFoundError("column not found")
+)
+
+// notFoundError is an error about a missing object; processing a message again doesn't help, as long as it's missing.
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+func (e notFoundError) Retryable() bool {
+	return false
+}
+
 type Service struct {
 	Client *github.Client
+	// Cache caches lookups of projects, their columns and fields; lookups aren't cached if it's nil.
+	Cache *Cache
 }
 
 type IssueProjectCardsResponse struct {
@@ -100,7 +170,8 @@ type Repository struct {
 }
 
 type ProjectCards struct {
-	Nodes []struct {
+	PageInfo PageInfo `json:"pageInfo"`
+	Nodes    []struct {
 		ID      string  `json:"id"`
 		Project Project `json:"project"`
 	} `json:"nodes"`
@@ -112,53 +183,154 @@ type Project struct {
 	ResourcePath string `json:"resourcePath"`
 }
 
+// IssueProjectCards returns issue's repository and all its project cards.
 func (svc *Service) IssueProjectCards(ctx context.Context, id string) (*IssueProjectCardsResponse, error) {
-	req := graphql.NewRequest(queryIssueProjectCards)
-	req.Var("id", id)
-
-	resp := &IssueProjectCardsResponse{}
-	err := svc.Client.Run(ctx, req, &resp)
-	return resp, err
+	result := &IssueProjectCardsResponse{}
+	err := svc.paginate(ctx, queryIssueProjectCards, map[string]interface{}{"id": id}, func(req *github.Request) (PageInfo, error) {
+		resp := &IssueProjectCardsResponse{}
+		if err := svc.Client.Run(ctx, req, &resp); err != nil {
+			return PageInfo{}, err
+		}
+		result.Node.Repository = resp.Node.Repository
+		result.Node.ProjectCards.Nodes = append(result.Node.ProjectCards.Nodes, resp.Node.ProjectCards.Nodes...)
+		return resp.Node.ProjectCards.PageInfo, nil
+	})
+	return result, err
 }
 
-func (svc *Service) AddIssueProjectCard(ctx context.Context, id, projectID string) (*IssueProjectCardsResponse, error) {
-	req := graphql.NewRequest(mutationAddIssueProjectCard)
-	req.Var("id", id)
-	req.Var("projectId", projectID)
+// AddIssueProjectCards adds the issue to the projects. The projects, the issue is already in, are kept,
+// as GitHub replaces issue's projects with the ones in the mutation.
+func (svc *Service) AddIssueProjectCards(ctx context.Context, id string, projectIDs []string) error {
+	cards, err := svc.IssueProjectCards(ctx, id)
+	if err != nil {
+		return xerrors.Errorf("could not get issue's projects: %w", err)
+	}
 
-	resp := struct {
-		UpdateIssue struct {
-			IssueProjectCardsResponse
-		} `json:"updateIssue"`
-	}{}
-	if err := svc.Client.Run(ctx, req, &resp); err != nil {
-		return nil, err
+	seen := make(map[string]bool)
+	var ids []string
+	for _, node := range cards.Node.ProjectCards.Nodes {
+		if projID := string(node.Project.ID); !seen[projID] {
+			seen[projID] = true
+			ids = append(ids, projID)
+		}
+	}
+	for _, projID := range projectIDs {
+		if !seen[projID] {
+			seen[projID] = true
+			ids = append(ids, projID)
+		}
 	}
-	return &resp.UpdateIssue.IssueProjectCardsResponse, nil
+
+	req := github.NewRequest(mutationAddIssueProjectCards)
+	req.Var("id", id)
+	req.Var("projectIds", ids)
+
+	return svc.Client.Run(ctx, req, nil)
 }
 
 type ProjectIDResponse struct {
 	github.Project
 }
 
-func (svc *Service) FindProjectID(ctx context.Context, projectPath string) (*ProjectIDResponse, error) {
-	parts := strings.SplitN(projectPath[1:], "/", 4)
-	if len(parts) != 4 {
-		return nil, xerrors.Errorf("bad project path %q", projectPath)
+// ProjectPath is a parsed resource path of a project.
+type ProjectPath struct {
+	// Owner is the login of the organization, the user or the owner of the repository, the project belongs to.
+	Owner string
+	// Repository is the name of the repository for repository's project; it's empty for other projects.
+	Repository string
+	// User is true for user's project.
+	User   bool
+	Number int
+}
+
+// ParseProjectPath parses project's resource path, e.g. "/orgs/adjust/projects/13" for organization's project,
+// "/users/narqo/projects/2" for user's project or "/adjust/backend/projects/1" for repository's project.
+func ParseProjectPath(projectPath string) (ProjectPath, error) {
+	parts := strings.SplitN(strings.TrimPrefix(projectPath, "/"), "/", 4)
+	if !strings.HasPrefix(projectPath, "/") || len(parts) != 4 || parts[0] == "" || parts[1] == "" || parts[2] != "projects" {
+		return ProjectPath{}, xerrors.Errorf("bad project path %q", projectPath)
 	}
 	number, err := strconv.Atoi(parts[3])
+	if err != nil || number <= 0 {
+		return ProjectPath{}, xerrors.Errorf("bad project number in %q", projectPath)
+	}
+	switch parts[0] {
+	case "orgs":
+		return ProjectPath{Owner: parts[1], Number: number}, nil
+	case "users":
+		return ProjectPath{Owner: parts[1], User: true, Number: number}, nil
+	}
+	return ProjectPath{Owner: parts[0], Repository: parts[1], Number: number}, nil
+}
+
+// FindProjectID returns the id of the classic project by its resource path. It returns ErrProjectNotFound,
+// if the project doesn't exist.
+func (svc *Service) FindProjectID(ctx context.Context, projectPath string) (*ProjectIDResponse, error) {
+	path, err := ParseProjectPath(projectPath)
 	if err != nil {
-		return nil, xerrors.Errorf("could not parse project %q: %w", projectPath, err)
+		return nil, err
 	}
-	if parts[0] == "orgs" {
-		return svc.findOrgProjectID(ctx, parts[1], number)
-	} else {
-		return svc.findRepoProjectID(ctx, parts[0], parts[1], number)
+	if path.User {
+		return nil, xerrors.Errorf("project %q: user's classic projects aren't supported", projectPath)
 	}
+
+	value, err := svc.cached(cacheProject, cacheKey(cacheProject, projectPath), func() (interface{}, error) {
+		var (
+			resp *ProjectIDResponse
+			err  error
+		)
+		if path.Repository == "" {
+			resp, err = svc.findOrgProjectID(ctx, path.Owner, path.Number)
+		} else {
+			resp, err = svc.findRepoProjectID(ctx, path.Owner, path.Repository, path.Number)
+		}
+		if err != nil {
+			return nil, projectError(projectPath, err)
+		}
+		if resp.ID == "" {
+			return nil, xerrors.Errorf("project %q: %w", projectPath, ErrProjectNotFound)
+		}
+		if svc.Cache != nil {
+			// project's columns are cached by its id, so they can be invalidated by the path
+			svc.Cache.setProjectID(projectPath, string(resp.ID))
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*ProjectIDResponse), nil
+}
+
+// projectError marks GitHub's NOT_FOUND error, e.g. "Could not resolve to a Project with the number 1.",
+// as ErrProjectNotFound.
+func projectError(projectPath string, err error) error {
+	if github.ErrorType(err) == github.ErrorTypeNotFound {
+		return &projectNotFoundError{projectPath, err}
+	}
+	return err
+}
+
+// projectNotFoundError is ErrProjectNotFound, that keeps GitHub's error in the chain.
+type projectNotFoundError struct {
+	path string
+	err  error
+}
+
+func (e *projectNotFoundError) Error() string {
+	return fmt.Sprintf("project %q: %v", e.path, e.err)
+}
+
+func (e *projectNotFoundError) Unwrap() error {
+	return e.err
+}
+
+func (e *projectNotFoundError) Is(target error) bool {
+	return target == ErrProjectNotFound
 }
 
 func (svc *Service) findOrgProjectID(ctx context.Context, login string, number int) (*ProjectIDResponse, error) {
-	req := graphql.NewRequest(queryFindOrdProjectID)
+	req := github.NewRequest(queryFindOrdProjectID)
 	req.Var("login", login)
 	req.Var("number", number)
 
@@ -174,7 +346,7 @@ func (svc *Service) findOrgProjectID(ctx context.Context, login string, number i
 }
 
 func (svc *Service) findRepoProjectID(ctx context.Context, owner, name string, number int) (*ProjectIDResponse, error) {
-	req := graphql.NewRequest(queryFindRepoProjectID)
+	req := github.NewRequest(queryFindRepoProjectID)
 	req.Var("owner", owner)
 	req.Var("name", name)
 	req.Var("number", number)
@@ -189,3 +361,95 @@ func (svc *Service) findRepoProjectID(ctx context.Context, owner, name string, n
 	}
 	return &resp.Repository.Project, nil
 }
+
+// ProjectColumnID returns the id of project's column by its name. All columns of the project are cached,
+// when a column is looked up. A missing column is cached for a shorter time, so a column, that was added
+// or renamed, is found soon.
+func (svc *Service) ProjectColumnID(ctx context.Context, projectID, column string) (string, error) {
+	value, err := svc.cached(cacheColumn, cacheKey(cacheColumn, projectID, column), func() (interface{}, error) {
+		columns, err := svc.projectColumns(ctx, projectID)
+		if err != nil {
+			return nil, err
+		}
+
+		var columnID string
+		for _, col := range columns {
+			if col.Name == column {
+				columnID = string(col.ID)
+			} else if svc.Cache != nil {
+				svc.Cache.add(cacheKey(cacheColumn, projectID, col.Name), string(col.ID), nil)
+			}
+		}
+		if columnID == "" {
+			return nil, xerrors.Errorf("project %s, column %q: %w", projectID, column, ErrColumnNotFound)
+		}
+		return columnID, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+func (svc *Service) projectColumns(ctx context.Context, projectID string) ([]github.Column, error) {
+	var columns []github.Column
+	err := svc.paginate(ctx, queryProjectColumns, map[string]interface{}{"id": projectID}, func(req *github.Request) (PageInfo, error) {
+		resp := struct {
+			Node struct {
+				Columns struct {
+					PageInfo PageInfo        `json:"pageInfo"`
+					Nodes    []github.Column `json:"nodes"`
+				} `json:"columns"`
+			} `json:"node"`
+		}{}
+		if err := svc.Client.Run(ctx, req, &resp); err != nil {
+			return PageInfo{}, err
+		}
+		columns = append(columns, resp.Node.Columns.Nodes...)
+		return resp.Node.Columns.PageInfo, nil
+	})
+	return columns, err
+}
+
+type ProjectCard struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// AddProjectCard creates a card for the content, e.g. an issue, in the project's column.
+func (svc *Service) AddProjectCard(ctx context.Context, columnID, contentID string) (*ProjectCard, error) {
+	req := github.NewRequest(mutationAddProjectCard)
+	req.Var("columnId", columnID)
+	req.Var("contentId", contentID)
+
+	resp := struct {
+		AddProjectCard struct {
+			CardEdge struct {
+				Node ProjectCard `json:"node"`
+			} `json:"cardEdge"`
+		} `json:"addProjectCard"`
+	}{}
+	if err := svc.Client.Run(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.AddProjectCard.CardEdge.Node, nil
+}
+
+// MoveProjectCard moves the card to the column of card's project.
+func (svc *Service) MoveProjectCard(ctx context.Context, cardID, columnID string) (*ProjectCard, error) {
+	req := github.NewRequest(mutationMoveProjectCard)
+	req.Var("cardId", cardID)
+	req.Var("columnId", columnID)
+
+	resp := struct {
+		MoveProjectCard struct {
+			CardEdge struct {
+				Node ProjectCard `json:"node"`
+			} `json:"cardEdge"`
+		} `json:"moveProjectCard"`
+	}{}
+	if err := svc.Client.Run(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.MoveProjectCard.CardEdge.Node, nil
+}
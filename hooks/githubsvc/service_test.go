@@ -0,0 +1,156 @@
+package githubsvc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adjust/hookeye/github"
+)
+
+// fakeGraphQL is a fake GitHub GraphQL API, that keeps the projects of a single issue.
+type fakeGraphQL struct {
+	mu       sync.Mutex
+	projects []string
+	// pageSize is the max number of cards in a page; all cards are returned in one page if it's 0
+	pageSize int
+	// cursors, the pages were requested after
+	cursors []string
+}
+
+func (f *fakeGraphQL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query     string `json:"query"`
+		Variables struct {
+			ProjectIDs []string `json:"projectIds"`
+			After      *string  `json:"after"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var data interface{}
+	switch {
+	case strings.Contains(req.Query, "query IssueProjectCards"):
+		var after string
+		if req.Variables.After != nil {
+			after = *req.Variables.After
+		}
+		f.cursors = append(f.cursors, after)
+		data = map[string]interface{}{"node": f.issue(after)}
+	case strings.Contains(req.Query, "mutation AddIssueProjectCards"):
+		// like GitHub, replace issue's projects
+		f.projects = req.Variables.ProjectIDs
+		data = map[string]interface{}{"updateIssue": map[string]interface{}{"issue": map[string]interface{}{"id": "I1"}}}
+	default:
+		http.Error(w, "unexpected query", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// issue returns the page of issue's cards, that follows the card with the cursor.
+func (f *fakeGraphQL) issue(after string) map[string]interface{} {
+	start := 0
+	for i, id := range f.projects {
+		if "cursor-"+id == after {
+			start = i + 1
+		}
+	}
+	end := len(f.projects)
+	if f.pageSize > 0 && start+f.pageSize < end {
+		end = start + f.pageSize
+	}
+
+	nodes := make([]map[string]interface{}, 0, end-start)
+	for _, id := range f.projects[start:end] {
+		nodes = append(nodes, map[string]interface{}{
+			"id":      "card-" + id,
+			"project": map[string]interface{}{"id": id, "resourcePath": "/orgs/adjust/projects/" + id},
+		})
+	}
+	pageInfo := map[string]interface{}{"hasNextPage": end < len(f.projects)}
+	if end > start {
+		pageInfo["endCursor"] = "cursor-" + f.projects[end-1]
+	}
+
+	return map[string]interface{}{
+		"repository": map[string]interface{}{"id": "R1", "name": "backend", "nameWithOwner": "adjust/backend"},
+		"projectCards": map[string]interface{}{
+			"pageInfo": pageInfo,
+			"nodes":    nodes,
+		},
+	}
+}
+
+func TestService_AddIssueProjectCards_KeepsProjects(t *testing.T) {
+	// a human already put the issue in project P1
+	fake := &fakeGraphQL{projects: []string{"P1"}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	svc := &Service{
+		Client: github.NewClient(srv.URL, "token"),
+	}
+
+	err := svc.AddIssueProjectCards(context.Background(), "I1", []string{"P2", "P1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := []string{"P1", "P2"}, fake.projects; !reflect.DeepEqual(want, got) {
+		t.Errorf("issue projects: want %v, got %v", want, got)
+	}
+}
+
+func TestService_IssueProjectCards_Pages(t *testing.T) {
+	fake := &fakeGraphQL{
+		projects: []string{"P1", "P2", "P3", "P4", "P5"},
+		pageSize: 2,
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	svc := &Service{
+		Client: github.NewClient(srv.URL, "token"),
+	}
+
+	resp, err := svc.IssueProjectCards(context.Background(), "I1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, node := range resp.Node.ProjectCards.Nodes {
+		got = append(got, string(node.Project.ID))
+	}
+	if want := fake.projects; !reflect.DeepEqual(want, got) {
+		t.Errorf("cards' projects: want %v, got %v", want, got)
+	}
+	if want := "adjust/backend"; resp.Node.Repository.NameWithOwner != want {
+		t.Errorf("repository: want %q, got %q", want, resp.Node.Repository.NameWithOwner)
+	}
+	if want := []string{"", "cursor-P2", "cursor-P4"}; !reflect.DeepEqual(want, fake.cursors) {
+		t.Errorf("cursors: want %v, got %v", want, fake.cursors)
+	}
+
+	// the project from the last page isn't added again
+	if err := svc.AddIssueProjectCards(context.Background(), "I1", []string{"P5", "P6"}); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []string{"P1", "P2", "P3", "P4", "P5", "P6"}, fake.projects; !reflect.DeepEqual(want, got) {
+		t.Errorf("issue projects: want %v, got %v", want, got)
+	}
+}
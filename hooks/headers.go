@@ -0,0 +1,17 @@
+package hooks
+
+// Headers of the messages, that GitHub webhooks are published to the stream with.
+const (
+	// HeaderEvent is the type of GitHub event, e.g. "issues".
+	HeaderEvent = "event"
+	// HeaderAction is the action of the event, e.g. "opened", if the event has one.
+	HeaderAction = "action"
+	// HeaderDelivery is the GUID of the webhook delivery.
+	HeaderDelivery = "delivery"
+	// HeaderRepository is the full name of the repository, e.g. "adjust/hookeye", if the event has one.
+	HeaderRepository = "repository"
+	// HeaderInstallation is the id of GitHub App's installation, that sent the webhook, if the event has one.
+	HeaderInstallation = "installation"
+	// HeaderTenant is the name of the tenant, that received the webhook; it's not set for the default tenant.
+	HeaderTenant = "tenant"
+)
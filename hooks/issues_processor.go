@@ -11,57 +11,160 @@ import (
 	"golang.org/x/xerrors"
 )
 
-// repo -> resourcePath
-var repoToProject = map[string]string{
-	"backend": "/orgs/adjust/projects/13", // "/adjust/backend/projects/1" for repo level project
-}
-
 type IssuesProcessor struct {
 	GithubService *githubsvc.Service
+	// Rules route issues to projects by repository
+	Rules *RulesStore
 }
 
 func (p *IssuesProcessor) Process(ctx context.Context, msg *stream.Message) error {
-	var issue github.Issue
-	if err := json.Unmarshal(msg.Data, &issue); err != nil {
-		return xerrors.Errorf("failed to unmarshal message %d: %w", msg.Offset, err)
+	var event github.IssuesEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		return stream.Permanent(xerrors.Errorf("failed to unmarshal message %d: %w", msg.Offset, err))
+	}
+	if event.Installation != nil {
+		// requests are authenticated as the installation of GitHub App, that sent the webhook
+		ctx = github.WithInstallation(ctx, event.Installation.ID)
 	}
 
+	// the message is processed with the rules, active when the processing started
+	rules := p.Rules.Rules()
+
+	switch event.Action {
+	case github.EventOpened:
+		return p.processIssueOpened(ctx, rules.Rules, event.Issue)
+	case github.EventClosed:
+		return p.moveIssueProjectCards(ctx, rules.Rules, event.Issue, ProjectTarget.doneColumn)
+	case github.EventReopened:
+		return p.moveIssueProjectCards(ctx, rules.Rules, event.Issue, ProjectTarget.reopenColumn)
+	default:
+		return nil
+	}
+}
+
+func (p *IssuesProcessor) processIssueOpened(ctx context.Context, rules *Rules, issue github.Issue) error {
 	cards, err := p.GithubService.IssueProjectCards(ctx, issue.NodeID)
 	if err != nil {
 		return xerrors.Errorf("failed to get issue project cards: %w", err)
 	}
 
 	repo := cards.Node.Repository
-	projPath := repoToProject[repo.Name]
-	if projPath == "" {
-		log.Printf("no project for repo %q\n", repo)
+	projects := rules.Match(repo.Name, repo.NameWithOwner)
+	if len(projects) == 0 {
+		log.Printf("no project for repo %q\n", repo.NameWithOwner)
+		return nil
+	}
+
+	attached := make(map[string]bool)
+	for _, node := range cards.Node.ProjectCards.Nodes {
+		attached[node.Project.ResourcePath] = true
+	}
+
+	var targets []ProjectTarget
+	for _, project := range projects {
+		if project.isV2() {
+			if err := addProjectV2Item(ctx, p.GithubService, project, issue.NodeID); err != nil {
+				return err
+			}
+		} else if !attached[project.Path] {
+			targets = append(targets, project)
+		}
+	}
+	if len(targets) == 0 {
+		log.Printf("nothing to be done for repo %v, issue %v\n", repo, issue)
 		return nil
 	}
 
-	nodes := cards.Node.ProjectCards.Nodes
-	if len(nodes) == 0 {
-		return p.createIssueProjectCard(ctx, projPath, issue.NodeID)
+	return p.createIssueProjectCards(ctx, targets, issue.NodeID)
+}
+
+// createIssueProjectCards adds the issue to the projects. Projects with a column get the card in that column,
+// other projects get the card wherever GitHub puts it.
+func (p *IssuesProcessor) createIssueProjectCards(ctx context.Context, targets []ProjectTarget, issueID string) error {
+	var projIDs []string
+	columnProjIDs := make(map[string]string)
+	for _, target := range targets {
+		projID, err := p.GithubService.FindProjectID(ctx, target.Path)
+		if err != nil {
+			return xerrors.Errorf("failed to get project id for %q: %w", target.Path, err)
+		}
+		if target.Column == "" {
+			projIDs = append(projIDs, string(projID.ID))
+		} else {
+			columnProjIDs[target.Path] = string(projID.ID)
+		}
+	}
+
+	if len(projIDs) > 0 {
+		err := p.GithubService.AddIssueProjectCards(ctx, issueID, projIDs)
+		if err != nil {
+			return xerrors.Errorf("failed to add project cards to issue %s, projects %v: %w", issueID, projIDs, err)
+		}
 	}
 
-	for _, node := range nodes {
-		if node.Project.ResourcePath == projPath {
-			log.Printf("nothing to be done for repo %v, issue %v\n", repo, issue)
-			return nil
+	for _, target := range targets {
+		if target.Column == "" {
+			continue
+		}
+		if err := p.createIssueColumnCard(ctx, target, columnProjIDs[target.Path], issueID); err != nil {
+			return err
 		}
 	}
 
-	return p.createIssueProjectCard(ctx, projPath, issue.NodeID)
+	return nil
 }
 
-func (p *IssuesProcessor) createIssueProjectCard(ctx context.Context, projPath, issueID string) error {
-	projID, err := p.GithubService.FindProjectID(ctx, projPath)
+func (p *IssuesProcessor) createIssueColumnCard(ctx context.Context, target ProjectTarget, projID, issueID string) error {
+	columnID, err := p.GithubService.ProjectColumnID(ctx, projID, target.Column)
 	if err != nil {
-		return xerrors.Errorf("failed to get project id for %q: %w", projPath, err)
+		return xerrors.Errorf("failed to get column %q of project %q: %w", target.Column, target.Path, err)
 	}
 
-	_, err = p.GithubService.AddIssueProjectCard(ctx, issueID, string(projID.ID))
+	_, err = p.GithubService.AddProjectCard(ctx, columnID, issueID)
 	if err != nil {
-		return xerrors.Errorf("failed to add project card to issue %s, project %s: %w", issueID, projID.ID, err)
+		return xerrors.Errorf("failed to add card for issue %s to column %q of project %q: %w", issueID, target.Column, target.Path, err)
+	}
+
+	return nil
+}
+
+// moveIssueProjectCards moves issue's cards in the projects, matched by the rules, to the column, returned by column.
+// Cards in other projects, and cards of the projects without an optional column, stay where they are.
+func (p *IssuesProcessor) moveIssueProjectCards(ctx context.Context, rules *Rules, issue github.Issue, column func(ProjectTarget) (string, bool)) error {
+	cards, err := p.GithubService.IssueProjectCards(ctx, issue.NodeID)
+	if err != nil {
+		return xerrors.Errorf("failed to get issue project cards: %w", err)
+	}
+
+	repo := cards.Node.Repository
+	targets := make(map[string]ProjectTarget)
+	for _, project := range rules.Match(repo.Name, repo.NameWithOwner) {
+		if !project.isV2() {
+			targets[project.Path] = project
+		}
+	}
+
+	for _, card := range cards.Node.ProjectCards.Nodes {
+		target, ok := targets[card.Project.ResourcePath]
+		if !ok {
+			continue
+		}
+		colName, optional := column(target)
+		if colName == "" {
+			continue
+		}
+
+		columnID, err := p.GithubService.ProjectColumnID(ctx, string(card.Project.ID), colName)
+		if optional && xerrors.Is(err, githubsvc.ErrColumnNotFound) {
+			log.Printf("no column %q in project %q for issue %v\n", colName, target.Path, issue)
+			continue
+		} else if err != nil {
+			return xerrors.Errorf("failed to get column %q of project %q: %w", colName, target.Path, err)
+		}
+
+		if _, err := p.GithubService.MoveProjectCard(ctx, card.ID, columnID); err != nil {
+			return xerrors.Errorf("failed to move card %s to column %q of project %q: %w", card.ID, colName, target.Path, err)
+		}
 	}
 
 	return nil
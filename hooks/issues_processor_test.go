@@ -0,0 +1,278 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adjust/hookeye/github"
+	"github.com/adjust/hookeye/hooks/githubsvc"
+	"github.com/adjust/hookeye/stream"
+)
+
+// fakeProject is a classic project of adjust organisation, "/orgs/adjust/projects/<number>".
+type fakeProject struct {
+	id string
+	// columns' ids by name
+	columns map[string]string
+}
+
+// fakeProjects is a fake GitHub GraphQL API, that keeps the cards of issue I1 of adjust/backend, and records
+// the changes made to them.
+type fakeProjects struct {
+	mu       sync.Mutex
+	projects map[int]fakeProject
+	// cards are the numbers of the projects, the issue has cards in
+	cards []int
+
+	// moved are the columns, the cards were moved to, by card's id
+	moved map[string]string
+	// added are the columns, the cards were added to
+	added []string
+	// updatedProjects are the projects, the issue was last updated with; like GitHub, they replace issue's projects
+	updatedProjects []string
+}
+
+func (f *fakeProjects) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query     string `json:"query"`
+		Variables struct {
+			ID         string   `json:"id"`
+			ProjectIDs []string `json:"projectIds"`
+			Login      string   `json:"login"`
+			Number     int      `json:"number"`
+			CardID     string   `json:"cardId"`
+			ColumnID   string   `json:"columnId"`
+			ContentID  string   `json:"contentId"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var data interface{}
+	switch {
+	case strings.Contains(req.Query, "query IssueProjectCards"):
+		data = map[string]interface{}{"node": f.issue()}
+	case strings.Contains(req.Query, "query FindProjectID"):
+		project, ok := f.projects[req.Variables.Number]
+		if req.Variables.Login != "adjust" || !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": {"organization": {"project": null}}, "errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a Project"}]}`))
+			return
+		}
+		data = map[string]interface{}{"organization": map[string]interface{}{"project": map[string]interface{}{"id": project.id, "name": "project"}}}
+	case strings.Contains(req.Query, "query ProjectColumns"):
+		data = map[string]interface{}{"node": map[string]interface{}{"columns": f.columns(req.Variables.ID)}}
+	case strings.Contains(req.Query, "mutation MoveProjectCard"):
+		f.moved[req.Variables.CardID] = req.Variables.ColumnID
+		data = map[string]interface{}{"moveProjectCard": map[string]interface{}{"cardEdge": map[string]interface{}{"node": map[string]interface{}{"id": req.Variables.CardID}}}}
+	case strings.Contains(req.Query, "mutation AddProjectCard"):
+		f.added = append(f.added, req.Variables.ColumnID)
+		data = map[string]interface{}{"addProjectCard": map[string]interface{}{"cardEdge": map[string]interface{}{"node": map[string]interface{}{"id": "card-" + req.Variables.ContentID}}}}
+	case strings.Contains(req.Query, "mutation AddIssueProjectCards"):
+		f.updatedProjects = req.Variables.ProjectIDs
+		data = map[string]interface{}{"updateIssue": map[string]interface{}{"issue": map[string]interface{}{"id": req.Variables.ID}}}
+	default:
+		http.Error(w, "unexpected query", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func (f *fakeProjects) issue() map[string]interface{} {
+	nodes := make([]map[string]interface{}, 0, len(f.cards))
+	for _, number := range f.cards {
+		nodes = append(nodes, map[string]interface{}{
+			"id":      "card-" + f.projects[number].id,
+			"project": map[string]interface{}{"id": f.projects[number].id, "resourcePath": "/orgs/adjust/projects/" + strconv.Itoa(number)},
+		})
+	}
+	return map[string]interface{}{
+		"repository": map[string]interface{}{"id": "R1", "name": "backend", "nameWithOwner": "adjust/backend"},
+		"projectCards": map[string]interface{}{
+			"pageInfo": map[string]interface{}{"hasNextPage": false},
+			"nodes":    nodes,
+		},
+	}
+}
+
+func (f *fakeProjects) columns(projectID string) map[string]interface{} {
+	nodes := []map[string]interface{}{}
+	for _, project := range f.projects {
+		if project.id != projectID {
+			continue
+		}
+		for name, id := range project.columns {
+			nodes = append(nodes, map[string]interface{}{"id": id, "name": name})
+		}
+	}
+	return map[string]interface{}{
+		"pageInfo": map[string]interface{}{"hasNextPage": false},
+		"nodes":    nodes,
+	}
+}
+
+// newIssuesProcessor returns the processor, that routes issues of backend repository to the projects,
+// with GitHub API at the url.
+func newIssuesProcessor(url string, projects ...ProjectTarget) *IssuesProcessor {
+	svc := &githubsvc.Service{
+		Client: github.NewClient(url, "token"),
+	}
+	store := NewRulesStore("", svc)
+	store.rules.Store(&LoadedRules{Rules: &Rules{Rules: []Rule{{Repository: "backend", Projects: projects}}}})
+
+	return &IssuesProcessor{GithubService: svc, Rules: store}
+}
+
+func issueMessage(t *testing.T, action github.EventAction) *stream.Message {
+	t.Helper()
+
+	data, err := json.Marshal(github.IssuesEvent{
+		Action: action,
+		Issue:  github.Issue{BaseEntity: github.BaseEntity{NodeID: "I1"}, Number: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &stream.Message{Data: data}
+}
+
+func TestIssuesProcessor_Process_Opened(t *testing.T) {
+	fake := &fakeProjects{
+		projects: map[int]fakeProject{
+			1: {id: "P1", columns: map[string]string{"Triage": "C1-triage"}},
+			2: {id: "P2"},
+			3: {id: "P3"},
+			4: {id: "P4"},
+		},
+		// the issue is already in project 4
+		cards: []int{4},
+		moved: make(map[string]string),
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	p := newIssuesProcessor(srv.URL,
+		ProjectTarget{Path: "/orgs/adjust/projects/1", Column: "Triage"},
+		ProjectTarget{Path: "/orgs/adjust/projects/2"},
+		ProjectTarget{Path: "/orgs/adjust/projects/3"},
+		ProjectTarget{Path: "/orgs/adjust/projects/4"},
+	)
+
+	if err := p.Process(context.Background(), issueMessage(t, github.EventOpened)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the project with a column gets the card in the column
+	if want := []string{"C1-triage"}; !reflect.DeepEqual(fake.added, want) {
+		t.Errorf("want cards added to columns %v, got %v", want, fake.added)
+	}
+	// projects without a column get the issue as a whole, and the issue stays in project 4
+	if want := []string{"P4", "P2", "P3"}; !reflect.DeepEqual(fake.updatedProjects, want) {
+		t.Errorf("want issue in projects %v, got %v", want, fake.updatedProjects)
+	}
+}
+
+func TestIssuesProcessor_Process_Closed(t *testing.T) {
+	cases := []struct {
+		name    string
+		targets []ProjectTarget
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			"default column",
+			[]ProjectTarget{
+				{Path: "/orgs/adjust/projects/1", Column: "Triage"},
+				// project 2 has no "Done" column, so the card stays where it is
+				{Path: "/orgs/adjust/projects/2"},
+			},
+			map[string]string{"card-P1": "C1-done"},
+			false,
+		},
+		{
+			"done column",
+			[]ProjectTarget{
+				{Path: "/orgs/adjust/projects/2", DoneColumn: "Shipped"},
+			},
+			map[string]string{"card-P2": "C2-shipped"},
+			false,
+		},
+		{
+			"missing done column",
+			[]ProjectTarget{
+				{Path: "/orgs/adjust/projects/1", DoneColumn: "Shipped"},
+			},
+			map[string]string{},
+			true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeProjects{
+				projects: map[int]fakeProject{
+					1: {id: "P1", columns: map[string]string{"Triage": "C1-triage", "Done": "C1-done"}},
+					2: {id: "P2", columns: map[string]string{"Todo": "C2-todo", "Shipped": "C2-shipped"}},
+					9: {id: "P9", columns: map[string]string{"Done": "C9-done"}},
+				},
+				// project 9 isn't in the rules
+				cards: []int{1, 2, 9},
+				moved: make(map[string]string),
+			}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			p := newIssuesProcessor(srv.URL, tc.targets...)
+
+			err := p.Process(context.Background(), issueMessage(t, github.EventClosed))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("want error %v, got %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(fake.moved, tc.want) {
+				t.Errorf("want cards moved %v, got %v", tc.want, fake.moved)
+			}
+		})
+	}
+}
+
+func TestIssuesProcessor_Process_Reopened(t *testing.T) {
+	fake := &fakeProjects{
+		projects: map[int]fakeProject{
+			1: {id: "P1", columns: map[string]string{"Triage": "C1-triage", "Done": "C1-done"}},
+			2: {id: "P2", columns: map[string]string{"Backlog": "C2-backlog", "Done": "C2-done"}},
+			3: {id: "P3", columns: map[string]string{"Done": "C3-done"}},
+			9: {id: "P9", columns: map[string]string{"Triage": "C9-triage"}},
+		},
+		cards: []int{1, 2, 3, 9},
+		moved: make(map[string]string),
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	p := newIssuesProcessor(srv.URL,
+		// reopened issues go back to the column, they were created in
+		ProjectTarget{Path: "/orgs/adjust/projects/1", Column: "Triage"},
+		ProjectTarget{Path: "/orgs/adjust/projects/2", Column: "Todo", ReopenColumn: "Backlog"},
+		// with no column, the card stays where it is
+		ProjectTarget{Path: "/orgs/adjust/projects/3"},
+	)
+
+	if err := p.Process(context.Background(), issueMessage(t, github.EventReopened)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"card-P1": "C1-triage", "card-P2": "C2-backlog"}
+	if !reflect.DeepEqual(fake.moved, want) {
+		t.Errorf("want cards moved %v, got %v", want, fake.moved)
+	}
+}
@@ -0,0 +1,45 @@
+package hooks
+
+import (
+	"context"
+	"sort"
+
+	"github.com/adjust/hookeye/hooks/githubsvc"
+	"golang.org/x/xerrors"
+)
+
+// addProjectV2Item adds the content, i.e. an issue or a pull request, to ProjectV2 and sets the fields of the item,
+// listed by the target.
+func addProjectV2Item(ctx context.Context, svc *githubsvc.Service, target ProjectTarget, contentID string) error {
+	proj, err := svc.FindProjectV2(ctx, target.Path)
+	if err != nil {
+		return xerrors.Errorf("failed to get project %q: %w", target.Path, err)
+	}
+
+	itemID, err := svc.AddProjectV2Item(ctx, proj.ID, contentID)
+	if err != nil {
+		return xerrors.Errorf("failed to add %s to project %q: %w", contentID, target.Path, err)
+	}
+
+	names := make([]string, 0, len(target.Fields))
+	for name := range target.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field, ok := proj.Field(name)
+		if !ok {
+			return xerrors.Errorf("project %q has no field %q", target.Path, name)
+		}
+		value, err := field.Value(target.Fields[name])
+		if err != nil {
+			return xerrors.Errorf("project %q: %w", target.Path, err)
+		}
+		if err := svc.SetProjectV2ItemFieldValue(ctx, proj.ID, itemID, field.ID, value); err != nil {
+			return xerrors.Errorf("failed to set field %q of item %s in project %q: %w", name, itemID, target.Path, err)
+		}
+	}
+
+	return nil
+}
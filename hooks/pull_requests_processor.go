@@ -0,0 +1,48 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/adjust/hookeye/github"
+	"github.com/adjust/hookeye/hooks/githubsvc"
+	"github.com/adjust/hookeye/stream"
+	"golang.org/x/xerrors"
+)
+
+// PullRequestsProcessor adds opened pull requests to ProjectV2 projects, matched by the rules.
+// Classic projects are left to the issues.
+type PullRequestsProcessor struct {
+	GithubService *githubsvc.Service
+	// Rules route pull requests to projects by repository
+	Rules *RulesStore
+}
+
+func (p *PullRequestsProcessor) Process(ctx context.Context, msg *stream.Message) error {
+	var event github.PullRequestEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		return stream.Permanent(xerrors.Errorf("failed to unmarshal message %d: %w", msg.Offset, err))
+	}
+	if event.Installation != nil {
+		// requests are authenticated as the installation of GitHub App, that sent the webhook
+		ctx = github.WithInstallation(ctx, event.Installation.ID)
+	}
+
+	if event.Action != github.EventOpened {
+		return nil
+	}
+
+	rules := p.Rules.Rules()
+
+	repo := event.Repository
+	for _, project := range rules.Match(repo.Name, repo.FullName) {
+		if !project.isV2() {
+			continue
+		}
+		if err := addProjectV2Item(ctx, p.GithubService, project, event.PullRequest.NodeID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
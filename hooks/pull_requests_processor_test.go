@@ -0,0 +1,186 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adjust/hookeye/github"
+	"github.com/adjust/hookeye/hooks/githubsvc"
+	"github.com/adjust/hookeye/stream"
+)
+
+// fakeProjectsV2 is a fake GitHub GraphQL API, that keeps ProjectV2 number 1 of adjust organisation,
+// and records the items and values, added to it.
+type fakeProjectsV2 struct {
+	mu sync.Mutex
+	// items are the contents, added to the project
+	items []string
+	// values are the values, set to items' fields, by item's and field's id
+	values map[string]string
+}
+
+func (f *fakeProjectsV2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query     string `json:"query"`
+		Variables struct {
+			Login     string          `json:"login"`
+			Number    int             `json:"number"`
+			ContentID string          `json:"contentId"`
+			ItemID    string          `json:"itemId"`
+			FieldID   string          `json:"fieldId"`
+			Value     json.RawMessage `json:"value"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var data interface{}
+	switch {
+	case strings.Contains(req.Query, "query FindOrgProjectV2"):
+		if req.Variables.Login != "adjust" || req.Variables.Number != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": {"organization": {"projectV2": null}}, "errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a ProjectV2"}]}`))
+			return
+		}
+		data = map[string]interface{}{"organization": map[string]interface{}{"projectV2": map[string]interface{}{
+			"id": "PVT_1",
+			"fields": map[string]interface{}{
+				"pageInfo": map[string]interface{}{"hasNextPage": false},
+				"nodes": []map[string]interface{}{
+					{"id": "F1", "name": "Estimate", "dataType": "NUMBER"},
+					{"id": "F2", "name": "Status", "dataType": "SINGLE_SELECT", "options": []map[string]string{{"id": "O1", "name": "Review"}}},
+				},
+			},
+		}}}
+	case strings.Contains(req.Query, "mutation AddProjectV2Item"):
+		f.items = append(f.items, req.Variables.ContentID)
+		data = map[string]interface{}{"addProjectV2ItemById": map[string]interface{}{"item": map[string]interface{}{"id": "item-" + req.Variables.ContentID}}}
+	case strings.Contains(req.Query, "mutation UpdateProjectV2ItemFieldValue"):
+		f.values[req.Variables.ItemID+"/"+req.Variables.FieldID] = string(req.Variables.Value)
+		data = map[string]interface{}{"updateProjectV2ItemFieldValue": map[string]interface{}{"projectV2Item": map[string]interface{}{"id": req.Variables.ItemID}}}
+	default:
+		http.Error(w, "unexpected query", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// newPullRequestsProcessor returns the processor, that routes pull requests of backend repository to the projects,
+// with GitHub API at the url.
+func newPullRequestsProcessor(url string, projects ...ProjectTarget) *PullRequestsProcessor {
+	svc := &githubsvc.Service{
+		Client: github.NewClient(url, "token"),
+	}
+	store := NewRulesStore("", svc)
+	store.rules.Store(&LoadedRules{Rules: &Rules{Rules: []Rule{{Repository: "backend", Projects: projects}}}})
+
+	return &PullRequestsProcessor{GithubService: svc, Rules: store}
+}
+
+func pullRequestMessage(t *testing.T, action github.EventAction, repo string) *stream.Message {
+	t.Helper()
+
+	data, err := json.Marshal(github.PullRequestEvent{
+		Action:      action,
+		PullRequest: github.PullRequest{BaseEntity: github.BaseEntity{NodeID: "PR1"}, Number: 1},
+		Repository:  github.Repository{Name: repo, FullName: "adjust/" + repo},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &stream.Message{Data: data}
+}
+
+func TestPullRequestsProcessor_Process(t *testing.T) {
+	cases := []struct {
+		name       string
+		action     github.EventAction
+		repo       string
+		targets    []ProjectTarget
+		wantItems  []string
+		wantValues map[string]string
+		wantErr    bool
+	}{
+		{
+			"opened",
+			github.EventOpened,
+			"backend",
+			[]ProjectTarget{
+				{Path: "/orgs/adjust/projects/1", Type: ProjectV2, Fields: map[string]string{"Status": "Review", "Estimate": "3"}},
+				// classic projects are left to the issues
+				{Path: "/orgs/adjust/projects/2"},
+			},
+			[]string{"PR1"},
+			map[string]string{"item-PR1/F1": `{"number":3}`, "item-PR1/F2": `{"singleSelectOptionId":"O1"}`},
+			false,
+		},
+		{
+			"closed",
+			github.EventClosed,
+			"backend",
+			[]ProjectTarget{{Path: "/orgs/adjust/projects/1", Type: ProjectV2}},
+			nil,
+			map[string]string{},
+			false,
+		},
+		{
+			"other repository",
+			github.EventOpened,
+			"frontend",
+			[]ProjectTarget{{Path: "/orgs/adjust/projects/1", Type: ProjectV2}},
+			nil,
+			map[string]string{},
+			false,
+		},
+		{
+			"missing field",
+			github.EventOpened,
+			"backend",
+			[]ProjectTarget{{Path: "/orgs/adjust/projects/1", Type: ProjectV2, Fields: map[string]string{"Sprint": "Sprint 1"}}},
+			[]string{"PR1"},
+			map[string]string{},
+			true,
+		},
+		{
+			"missing project",
+			github.EventOpened,
+			"backend",
+			[]ProjectTarget{{Path: "/orgs/adjust/projects/3", Type: ProjectV2}},
+			nil,
+			map[string]string{},
+			true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeProjectsV2{values: make(map[string]string)}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			p := newPullRequestsProcessor(srv.URL, tc.targets...)
+
+			err := p.Process(context.Background(), pullRequestMessage(t, tc.action, tc.repo))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("want error %v, got %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(fake.items, tc.wantItems) {
+				t.Errorf("want items %v, got %v", tc.wantItems, fake.items)
+			}
+			if !reflect.DeepEqual(fake.values, tc.wantValues) {
+				t.Errorf("want values %v, got %v", tc.wantValues, fake.values)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/adjust/hookeye/github"
+	"github.com/adjust/hookeye/hooks/githubsvc"
+	"golang.org/x/xerrors"
+)
+
+// Rules route issues of repositories to projects. Rules are loaded from a JSON file, e.g.
+//
+//	{
+//	  "rules": [
+//	    {"repository": "backend", "projects": ["/orgs/adjust/projects/13"]},
+//	    {"repository": "adjust/*", "projects": [{"path": "/orgs/adjust/projects/1", "column": "Triage"}]}
+//	  ]
+//	}
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule routes issues of the repositories, matching the pattern, to the projects.
+type Rule struct {
+	// Repository is the name of the repository ("backend"), its full name ("adjust/backend"),
+	// or a glob pattern of either (see path.Match), e.g. "adjust/*".
+	// Patterns with "/" are matched against the full name, other patterns are matched against the name.
+	Repository string          `json:"repository"`
+	Projects   []ProjectTarget `json:"projects"`
+}
+
+// Types of the projects.
+const (
+	// ProjectClassic is a classic project with columns and cards.
+	ProjectClassic = "classic"
+	// ProjectV2 is a project of the new "Projects" experience with items and custom fields.
+	ProjectV2 = "v2"
+)
+
+// ProjectTarget is a project, the issues are added to. In JSON, a target can be written as an object
+// or as a string with project's resource path.
+type ProjectTarget struct {
+	// Path is project's resource path (see githubsvc.ParseProjectPath). In the rules file, it can be
+	// project's web URL, e.g. "https://github.com/orgs/adjust/projects/13" (see ParseRules).
+	Path string `json:"path"`
+	// Type is the type of the project: ProjectClassic (by default) or ProjectV2.
+	Type string `json:"type,omitempty"`
+
+	// Fields of ProjectV2 item to set, by field's name, e.g. {"Status": "Triage", "Estimate": "3"}
+	// (see githubsvc.ProjectV2Field.Value).
+	Fields map[string]string `json:"fields,omitempty"`
+	// Column is the name of the column, issue's card is created in, e.g. "Triage".
+	// If it's empty, GitHub adds the card to the project without a column.
+	Column string `json:"column,omitempty"`
+	// DoneColumn is the name of the column, the card is moved to, when the issue is closed.
+	// If it's empty, the card is moved to "Done" column, if the project has one.
+	DoneColumn string `json:"done_column,omitempty"`
+	// ReopenColumn is the name of the column, the card is moved to, when the issue is reopened.
+	// If it's empty, the card is moved to Column; if both are empty, the card stays where it is.
+	ReopenColumn string `json:"reopen_column,omitempty"`
+}
+
+// defaultDoneColumn is the column, cards of closed issues are moved to, unless the target sets another one.
+const defaultDoneColumn = "Done"
+
+// doneColumn returns the column for closed issues; the column is optional, if it's the default one.
+func (t ProjectTarget) doneColumn() (column string, optional bool) {
+	if t.DoneColumn != "" {
+		return t.DoneColumn, false
+	}
+	return defaultDoneColumn, true
+}
+
+// reopenColumn returns the column for reopened issues.
+func (t ProjectTarget) reopenColumn() (column string, optional bool) {
+	if t.ReopenColumn != "" {
+		return t.ReopenColumn, false
+	}
+	return t.Column, false
+}
+
+func (t *ProjectTarget) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &t.Path)
+	}
+
+	type target ProjectTarget
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*target)(t))
+}
+
+// ParseRules decodes the rules from JSON and validates them. Projects, given by their web URLs under webURL
+// (github.com, if it's empty), are replaced with their resource paths.
+func ParseRules(data []byte, webURL string) (*Rules, error) {
+	rules := &Rules{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(rules); err != nil {
+		return nil, xerrors.Errorf("could not decode rules: %w", err)
+	}
+	if err := rules.resolveURLs(webURL); err != nil {
+		return nil, err
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// resolveURLs replaces web URLs of the projects with their resource paths, that GitHub reports for the projects.
+func (rules *Rules) resolveURLs(webURL string) error {
+	for i, rule := range rules.Rules {
+		for j, project := range rule.Projects {
+			if project.Path == "" || strings.HasPrefix(project.Path, "/") {
+				continue
+			}
+			path, err := github.ResourcePath(webURL, project.Path)
+			if err != nil {
+				return xerrors.Errorf("rule %d: bad project: %w", i, err)
+			}
+			rule.Projects[j].Path = path
+		}
+	}
+	return nil
+}
+
+// Validate checks that every rule has a valid repository pattern and valid project paths.
+func (rules *Rules) Validate() error {
+	for i, rule := range rules.Rules {
+		if rule.Repository == "" {
+			return xerrors.Errorf("rule %d: no repository", i)
+		}
+		if strings.Count(rule.Repository, "/") > 1 {
+			return xerrors.Errorf("rule %d: bad repository %q", i, rule.Repository)
+		}
+		if _, err := path.Match(rule.Repository, ""); err != nil {
+			return xerrors.Errorf("rule %d: bad repository %q: %w", i, rule.Repository, err)
+		}
+		if len(rule.Projects) == 0 {
+			return xerrors.Errorf("rule %d: no projects for repository %q", i, rule.Repository)
+		}
+		for _, project := range rule.Projects {
+			if err := project.validate(); err != nil {
+				return xerrors.Errorf("rule %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (t ProjectTarget) validate() error {
+	path, err := githubsvc.ParseProjectPath(t.Path)
+	if err != nil {
+		return err
+	}
+
+	switch t.Type {
+	case "", ProjectClassic:
+		if path.User {
+			return xerrors.Errorf("project %q: user's classic projects aren't supported", t.Path)
+		}
+		if len(t.Fields) > 0 {
+			return xerrors.Errorf("project %q: fields are supported by %s projects only", t.Path, ProjectV2)
+		}
+	case ProjectV2:
+		if path.Repository != "" {
+			return xerrors.Errorf("project %q: %s project must belong to an organization or a user", t.Path, ProjectV2)
+		}
+		if t.Column != "" || t.DoneColumn != "" || t.ReopenColumn != "" {
+			return xerrors.Errorf("project %q: columns are supported by %s projects only", t.Path, ProjectClassic)
+		}
+	default:
+		return xerrors.Errorf("project %q: bad type %q", t.Path, t.Type)
+	}
+	return nil
+}
+
+func (t ProjectTarget) isV2() bool {
+	return t.Type == ProjectV2
+}
+
+// Match returns the projects of all rules, matching the repository, in the order of the rules.
+// A project, that is listed by several rules, is returned once.
+func (rules *Rules) Match(name, fullName string) []ProjectTarget {
+	if rules == nil {
+		return nil
+	}
+
+	var (
+		projects []ProjectTarget
+		seen     = make(map[string]bool)
+	)
+	for _, rule := range rules.Rules {
+		if !rule.match(name, fullName) {
+			continue
+		}
+		for _, project := range rule.Projects {
+			if !seen[project.Path] {
+				seen[project.Path] = true
+				projects = append(projects, project)
+			}
+		}
+	}
+	return projects
+}
+
+func (rule Rule) match(name, fullName string) bool {
+	s := name
+	if strings.Contains(rule.Repository, "/") {
+		s = fullName
+	}
+	ok, _ := path.Match(rule.Repository, s)
+	return ok
+}
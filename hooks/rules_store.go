@@ -0,0 +1,200 @@
+package hooks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adjust/hookeye/hooks/githubsvc"
+	"golang.org/x/xerrors"
+)
+
+// LoadedRules is a version of the rules, loaded from the rules file.
+type LoadedRules struct {
+	*Rules
+
+	// Version is the number of the load, starting from 1; it's 0 if no rules were loaded.
+	Version int `json:"version"`
+	// Hash is the SHA-256 of the rules file.
+	Hash     string    `json:"hash,omitempty"`
+	LoadedAt time.Time `json:"loaded_at,omitempty"`
+}
+
+// RulesStore holds the active rules and reloads them from the file. Reloaded rules replace the active ones
+// only if they are valid, and all their projects exist.
+type RulesStore struct {
+	Filename      string
+	GithubService *githubsvc.Service
+
+	// serialises reloads
+	mu      sync.Mutex
+	modTime time.Time
+	rules   atomic.Value // *LoadedRules
+}
+
+func NewRulesStore(filename string, svc *githubsvc.Service) *RulesStore {
+	store := &RulesStore{
+		Filename:      filename,
+		GithubService: svc,
+	}
+	store.rules.Store(&LoadedRules{Rules: &Rules{}})
+	return store
+}
+
+// Rules returns the active rules. The returned rules are never modified, so a message is processed
+// with the same rules, even if the rules are reloaded in the middle of processing.
+func (store *RulesStore) Rules() *LoadedRules {
+	return store.rules.Load().(*LoadedRules)
+}
+
+// Load reads the rules from the file and makes them active. Rules are left unchanged if the file isn't changed
+// since the last load. It's a no-op if the store has no file.
+func (store *RulesStore) Load(ctx context.Context) error {
+	if store.Filename == "" {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	info, err := os.Stat(store.Filename)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(store.Filename)
+	if err != nil {
+		return err
+	}
+	// the file isn't checked again until it's modified, even if the rules in it aren't valid
+	store.modTime = info.ModTime()
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	active := store.Rules()
+	if hash == active.Hash {
+		return nil
+	}
+
+	rules, err := ParseRules(data, store.GithubService.Client.WebURL)
+	if err != nil {
+		return xerrors.Errorf("bad rules %s: %w", store.Filename, err)
+	}
+	if err := store.resolveProjects(ctx, rules); err != nil {
+		return xerrors.Errorf("bad rules %s: %w", store.Filename, err)
+	}
+
+	store.rules.Store(&LoadedRules{
+		Rules:    rules,
+		Version:  active.Version + 1,
+		Hash:     hash,
+		LoadedAt: time.Now(),
+	})
+	// lookups of the projects, cached before the reload, may be stale, e.g. if the reload follows a renamed column
+	for _, rule := range rules.Rules {
+		for _, project := range rule.Projects {
+			store.GithubService.InvalidateProject(project.Path)
+		}
+	}
+
+	log.Printf("hooks: loaded rules %s, version %d, hash %s\n", store.Filename, active.Version+1, hash)
+
+	return nil
+}
+
+// resolveProjects checks that all projects, columns and fields, the rules refer to, exist.
+// The rules are checked against the projects, as they're now, not as they were cached; the lookups
+// bypass the cache, so rules, that are rejected, don't affect the cached lookups of the active rules.
+func (store *RulesStore) resolveProjects(ctx context.Context, rules *Rules) error {
+	svc := &githubsvc.Service{Client: store.GithubService.Client}
+
+	projIDs := make(map[string]string)
+	for _, rule := range rules.Rules {
+		for _, project := range rule.Projects {
+			if project.isV2() {
+				if err := resolveProjectV2(ctx, svc, project); err != nil {
+					return err
+				}
+				continue
+			}
+
+			projID, ok := projIDs[project.Path]
+			if !ok {
+				resp, err := svc.FindProjectID(ctx, project.Path)
+				if err != nil {
+					return xerrors.Errorf("could not find project %q: %w", project.Path, err)
+				}
+				projID = string(resp.ID)
+				projIDs[project.Path] = projID
+			}
+
+			for _, column := range []string{project.Column, project.DoneColumn, project.ReopenColumn} {
+				if column == "" {
+					continue
+				}
+				if _, err := svc.ProjectColumnID(ctx, projID, column); err != nil {
+					return xerrors.Errorf("could not find column %q of project %q: %w", column, project.Path, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Watch reloads the rules, when the modification time of the file changes, until ctx is done.
+func (store *RulesStore) Watch(ctx context.Context, interval time.Duration) {
+	if store.Filename == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		info, err := os.Stat(store.Filename)
+		if err != nil {
+			log.Printf("hooks: failed to check rules %s: %v\n", store.Filename, err)
+			continue
+		}
+
+		store.mu.Lock()
+		changed := !info.ModTime().Equal(store.modTime)
+		store.mu.Unlock()
+
+		if changed {
+			if err := store.Load(ctx); err != nil {
+				log.Printf("hooks: failed to reload rules, keeping version %d: %v\n", store.Rules().Version, err)
+			}
+		}
+	}
+}
+
+// resolveProjectV2 checks that ProjectV2 exists, and the values of target's fields fit project's fields.
+func resolveProjectV2(ctx context.Context, svc *githubsvc.Service, target ProjectTarget) error {
+	proj, err := svc.FindProjectV2(ctx, target.Path)
+	if err != nil {
+		return xerrors.Errorf("could not find project %q: %w", target.Path, err)
+	}
+	for name, value := range target.Fields {
+		field, ok := proj.Field(name)
+		if !ok {
+			return xerrors.Errorf("project %q has no field %q", target.Path, name)
+		}
+		if _, err := field.Value(value); err != nil {
+			return xerrors.Errorf("project %q: %w", target.Path, err)
+		}
+	}
+	return nil
+}
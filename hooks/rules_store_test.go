@@ -0,0 +1,122 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adjust/hookeye/github"
+	"github.com/adjust/hookeye/hooks/githubsvc"
+)
+
+func TestRulesStore_Load(t *testing.T) {
+	// the project 404 doesn't exist; columns can't be looked up, while columnsDown is set
+	var columnsDown int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string `json:"query"`
+			Variables struct {
+				Number int `json:"number"`
+			} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(req.Query, "query ProjectColumns") {
+			if atomic.LoadInt32(&columnsDown) == 1 {
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{"data": {"node": {"columns": {"pageInfo": {"hasNextPage": false}, "nodes": [{"id": "C1", "name": "Triage"}]}}}}`))
+			return
+		}
+		if req.Variables.Number == 404 {
+			w.Write([]byte(`{"data": {"organization": {"project": null}}, "errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a Project"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"organization": {"project": {"id": "P1", "name": "project"}}}}`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "hookeye-rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "rules.json")
+	writeRules := func(data string) {
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	svc := &githubsvc.Service{
+		Client: github.NewClient(srv.URL, "token"),
+		Cache:  githubsvc.NewCache(10, time.Hour, time.Hour),
+	}
+	store := NewRulesStore(filename, svc)
+
+	ctx := context.Background()
+
+	writeRules(`{"rules": [{"repository": "backend", "projects": ["/orgs/adjust/projects/13"]}]}`)
+	if err := store.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rules := store.Rules()
+	if rules.Version != 1 || len(rules.Match("backend", "adjust/backend")) != 1 {
+		t.Fatalf("want version 1 routing backend, got %+v", rules)
+	}
+
+	// loading the same file keeps the version
+	if err := store.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Rules().Version; got != 1 {
+		t.Errorf("reload of unchanged file: want version 1, got %d", got)
+	}
+
+	// processing caches the lookups of the active rules
+	if _, err := svc.ProjectColumnID(ctx, "P1", "Triage"); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&columnsDown, 1)
+	writeRules(`{"rules": [{"repository": "backend", "projects": [{"path": "/orgs/adjust/projects/13", "column": "Triage"}]}]}`)
+	if err := store.Load(ctx); err == nil {
+		t.Errorf("want error, when columns can't be looked up")
+	}
+	if got := store.Rules(); got != rules {
+		t.Errorf("want rules to be kept after failed reload, got version %d", got.Version)
+	}
+	// the failed reload leaves the cached lookups alone
+	if _, err := svc.ProjectColumnID(ctx, "P1", "Triage"); err != nil {
+		t.Errorf("want column's lookup to stay cached after failed reload, got %v", err)
+	}
+	atomic.StoreInt32(&columnsDown, 0)
+
+	writeRules(`{"rules": [{"repository": "backend", "projects": ["/orgs/adjust/projects/404"]}]}`)
+	if err := store.Load(ctx); err == nil {
+		t.Errorf("want error for unknown project")
+	}
+
+	writeRules(`{"rules": [{"repository": "frontend", "projects": ["/orgs/adjust/projects/14"]}]}`)
+	if err := store.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Rules(); got.Version != 2 || got.Hash == rules.Hash || len(got.Match("backend", "adjust/backend")) != 0 {
+		t.Errorf("want version 2 without backend, got %+v", got)
+	}
+	// rules, taken before the reload, are unchanged
+	if len(rules.Match("backend", "adjust/backend")) != 1 {
+		t.Errorf("want old rules to route backend")
+	}
+}
@@ -0,0 +1,80 @@
+package hooks
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRules_Match(t *testing.T) {
+	var rules Rules
+	err := json.Unmarshal([]byte(`{
+		"rules": [
+			{"repository": "backend", "projects": ["/orgs/adjust/projects/13"]},
+			{"repository": "adjust/*", "projects": [{"path": "/orgs/adjust/projects/1"}, "/orgs/adjust/projects/13"]},
+			{"repository": "other/backend", "projects": [{"path": "/other/backend/projects/2", "column": "Triage"}]}
+		]
+	}`), &rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name, fullName string
+		want           []ProjectTarget
+	}{
+		{"backend", "adjust/backend", []ProjectTarget{{Path: "/orgs/adjust/projects/13"}, {Path: "/orgs/adjust/projects/1"}}},
+		{"frontend", "adjust/frontend", []ProjectTarget{{Path: "/orgs/adjust/projects/1"}, {Path: "/orgs/adjust/projects/13"}}},
+		{"backend", "other/backend", []ProjectTarget{{Path: "/orgs/adjust/projects/13"}, {Path: "/other/backend/projects/2", Column: "Triage"}}},
+		{"frontend", "other/frontend", nil},
+	}
+	for _, tc := range cases {
+		if got := rules.Match(tc.name, tc.fullName); !reflect.DeepEqual(tc.want, got) {
+			t.Errorf("%s: want %v, got %v", tc.fullName, tc.want, got)
+		}
+	}
+}
+
+func TestRules_Validate(t *testing.T) {
+	cases := []Rule{
+		{Repository: "", Projects: []ProjectTarget{{Path: "/orgs/adjust/projects/1"}}},
+		{Repository: "adjust/[", Projects: []ProjectTarget{{Path: "/orgs/adjust/projects/1"}}},
+		{Repository: "a/b/c", Projects: []ProjectTarget{{Path: "/orgs/adjust/projects/1"}}},
+		{Repository: "backend"},
+		{Repository: "backend", Projects: []ProjectTarget{{Path: "orgs/adjust/projects/1"}}},
+		{Repository: "backend", Projects: []ProjectTarget{{Path: "/orgs/adjust/boards/1"}}},
+		{Repository: "backend", Projects: []ProjectTarget{{Path: "/orgs/adjust/projects/x"}}},
+		{Repository: "backend", Projects: []ProjectTarget{{Path: "/users/narqo/projects/1"}}},
+		{Repository: "backend", Projects: []ProjectTarget{{Path: "/orgs/adjust/projects/1", Type: "v3"}}},
+		{Repository: "backend", Projects: []ProjectTarget{{Path: "/adjust/backend/projects/1", Type: ProjectV2}}},
+		{Repository: "backend", Projects: []ProjectTarget{{Path: "/orgs/adjust/projects/1", Type: ProjectV2, Column: "Triage"}}},
+		{Repository: "backend", Projects: []ProjectTarget{{Path: "/orgs/adjust/projects/1", Fields: map[string]string{"Status": "Triage"}}}},
+	}
+	for _, rule := range cases {
+		rules := &Rules{Rules: []Rule{rule}}
+		if err := rules.Validate(); err == nil {
+			t.Errorf("%+v: want error", rule)
+		}
+	}
+}
+
+func TestParseRules_URLs(t *testing.T) {
+	data := []byte(`{"rules": [{"repository": "backend", "projects": ["https://ghe.example.com/orgs/adjust/projects/13/", {"path": "/orgs/adjust/projects/1"}]}]}`)
+
+	rules, err := ParseRules(data, "https://ghe.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	projects := rules.Rules[0].Projects
+	if projects[0].Path != "/orgs/adjust/projects/13" || projects[1].Path != "/orgs/adjust/projects/1" {
+		t.Errorf("want resource paths, got %+v", projects)
+	}
+
+	// projects of another GitHub are rejected
+	if _, err := ParseRules(data, ""); err == nil {
+		t.Error("want error for project on another host")
+	}
+}
@@ -2,60 +2,142 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
-	"github.com/adjust/hookeye/github"
 	"github.com/adjust/hookeye/hooks"
-	"github.com/adjust/hookeye/hooks/githubsvc"
 	"github.com/adjust/hookeye/stream"
-	"github.com/machinebox/graphql"
 	"github.com/peterbourgon/ff"
+	"golang.org/x/xerrors"
 )
 
-const defaultGitHubAPIEndpoint = "https://api.github.com/graphql"
+var (
+	githubIssuesTopic       = GithubTopic(GithubEventIssues)
+	githubPullRequestsTopic = GithubTopic(GithubEventPullRequest)
+)
+
+const (
+	issuesProcessorGroup       = "issues-processor"
+	pullRequestsProcessorGroup = "pull-requests-processor"
+)
 
-const githubIssuesTopic = "github/issues"
+// deliveriesFile is the file in the stream directory, that keeps recent webhook deliveries.
+const deliveriesFile = "deliveries.jsonl"
 
 type Config struct {
 	Addr        string
+	AdminAddr   string
 	ExitTimeout time.Duration
 
+	StreamDir             string
+	StreamSegmentSize     int64
+	StreamSync            stream.SyncPolicy
+	StreamSyncInterval    time.Duration
 	StreamCompactInterval time.Duration
 
+	HooksMaxAttempts        int
+	HooksInitialBackoff     time.Duration
+	HooksMaxBackoff         time.Duration
+	HooksRulesFile          string
+	HooksRulesCheckInterval time.Duration
+
+	TenantsFile string
+
+	GithubURL           string
 	GithubAPIEndpoint   string
+	GithubRESTEndpoint  string
+	GithubCAFile        string
 	GithubClientTimeout time.Duration
 	GithubToken         string
-	GithubSecret        string
+	GithubAppID         int64
+	GithubAppKeyFile    string
+	GithubAppInstallID  int64
+	GithubSecrets       []string
+	GithubRequireSHA256 bool
+	GithubDedupTTL      time.Duration
+	GithubDedupSize     int
+	GithubCacheTTL      time.Duration
+	GithubCacheNegTTL   time.Duration
+	GithubCacheSize     int
+	GithubRateReserve   int
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "stream" {
+		if err := runStreamCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	var conf Config
 
 	flag.StringVar(&conf.Addr, "addr", ":10080", "address to listen")
+	flag.StringVar(&conf.AdminAddr, "admin.addr", "localhost:10081", "address to listen for admin API (disabled if empty)")
 	flag.DurationVar(&conf.ExitTimeout, "exit-timeout", 5*time.Second, "exit timeout")
 
+	flag.StringVar(&conf.StreamDir, "stream.dir", "", "directory to persist stream topics in (topics are kept in memory if empty)")
+	flag.Int64Var(&conf.StreamSegmentSize, "stream.segment-size", stream.DefaultSegmentSize, "max size of topic's log segment file in bytes")
+	flag.Var(&conf.StreamSync, "stream.sync", "when to flush topic's log to disk: always, interval or never")
+	flag.DurationVar(&conf.StreamSyncInterval, "stream.sync-interval", time.Second, "min interval between flushes of topic's log with -stream.sync=interval")
 	flag.DurationVar(&conf.StreamCompactInterval, "stream.compact-interval", time.Minute, "stream compaction interval")
 
-	flag.StringVar(&conf.GithubAPIEndpoint, "github.api-endpoint", defaultGitHubAPIEndpoint, "github api graphql endpoint")
+	flag.IntVar(&conf.HooksMaxAttempts, "hooks.max-attempts", 10, "max attempts to process a message before it's moved to dead-letter topic (0 means no limit)")
+	flag.DurationVar(&conf.HooksInitialBackoff, "hooks.initial-backoff", time.Second, "delay before a failed message is processed again")
+	flag.DurationVar(&conf.HooksMaxBackoff, "hooks.max-backoff", 5*time.Minute, "max delay between attempts to process a message")
+
+	flag.StringVar(&conf.HooksRulesFile, "hooks.rules", "", "JSON file with rules, that route issues of repositories to projects")
+	flag.DurationVar(&conf.HooksRulesCheckInterval, "hooks.rules-check-interval", 10*time.Second, "interval to check the rules file for changes (0 disables)")
+
+	flag.StringVar(&conf.TenantsFile, "tenants", "", "JSON file with tenants, that receive webhooks at /github/<tenant> with their own secrets, credentials and rules")
+
+	flag.StringVar(&conf.GithubURL, "github.url", "", "base url of github enterprise server, e.g. https://ghe.example.com, api endpoints are derived from (github.com if empty)")
+	flag.StringVar(&conf.GithubAPIEndpoint, "github.api-endpoint", "", "github api graphql endpoint (derived from -github.url if empty)")
+	flag.StringVar(&conf.GithubRESTEndpoint, "github.rest-endpoint", "", "github rest api endpoint, used to create tokens of github app (derived from -github.url if empty)")
+	flag.StringVar(&conf.GithubCAFile, "github.ca-file", "", "PEM file with CA certificates to trust in addition to system's roots, e.g. of github enterprise server")
+	flag.Int64Var(&conf.GithubAppID, "github.app-id", 0, "id of github app to authenticate as, instead of GITHUB_TOKEN")
+	flag.StringVar(&conf.GithubAppKeyFile, "github.app-key", "", "PEM file with the private key of github app")
+	flag.Int64Var(&conf.GithubAppInstallID, "github.app-installation-id", 0, "installation of github app to use, when the webhook has no installation, e.g. to check the rules")
+	flag.BoolVar(&conf.GithubRequireSHA256, "github.require-sha256", false, "reject webhooks without sha256 signature")
+	flag.DurationVar(&conf.GithubDedupTTL, "github.dedup-ttl", defaultDeliveriesTTL, "how long to remember webhook deliveries to skip redelivered ones")
+	flag.IntVar(&conf.GithubDedupSize, "github.dedup-size", defaultDeliveriesSize, "max number of webhook deliveries to remember")
 	flag.DurationVar(&conf.GithubClientTimeout, "github.client.timeout", 0, "github api client request timeout")
+	flag.DurationVar(&conf.GithubCacheTTL, "github.cache-ttl", time.Hour, "how long to cache looked up projects, columns and fields (0 disables)")
+	flag.DurationVar(&conf.GithubCacheNegTTL, "github.cache-negative-ttl", time.Minute, "how long to cache missing projects and columns (0 disables)")
+	flag.IntVar(&conf.GithubCacheSize, "github.cache-size", 1000, "max number of cached lookups")
+	flag.IntVar(&conf.GithubRateReserve, "github.rate-limit-reserve", 100, "rate limit points to leave unused; processing pauses until the limit resets, when the budget drops to the reserve")
 
-	// TODO(narqo): parse config from file
-	ff.Parse(flag.CommandLine, os.Args[1:])
+	flag.String("config", "", "config file with flags, one \"flag value\" per line")
+
+	err := ff.Parse(flag.CommandLine, os.Args[1:],
+		ff.WithConfigFileFlag("config"),
+		ff.WithConfigFileParser(ff.PlainParser),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// read github token from env
+	// read github token from env; it isn't needed, if hookeye authenticates as github app, or tenants have their own
 	conf.GithubToken = os.Getenv("GITHUB_TOKEN")
-	if conf.GithubToken == "" {
+	if conf.GithubToken == "" && conf.GithubAppID == 0 && conf.TenantsFile == "" {
 		log.Fatal("env: no GITHUB_TOKEN")
 	}
+	if conf.GithubAppID != 0 && conf.GithubAppKeyFile == "" {
+		log.Fatal("flags: no -github.app-key for -github.app-id")
+	}
+	if conf.GithubAppID != 0 && conf.HooksRulesFile != "" && conf.GithubAppInstallID == 0 && conf.TenantsFile == "" {
+		log.Fatal("flags: no -github.app-installation-id to check -hooks.rules as")
+	}
 
-	// read github secret from env (see https://developer.github.com/webhooks/securing/)
-	conf.GithubSecret = os.Getenv("GITHUB_SECRET")
+	// read comma-separated github secrets from env (see https://developer.github.com/webhooks/securing/)
+	conf.GithubSecrets = ParseSecrets(os.Getenv("GITHUB_SECRET"))
 
 	if err := run(context.Background(), conf); err != nil {
 		log.Fatal(err)
@@ -63,7 +145,44 @@ func main() {
 }
 
 func run(ctx context.Context, conf Config) error {
-	stream := stream.New()
+	tenantConfigs := []TenantConfig{defaultTenant(conf)}
+	if conf.TenantsFile != "" {
+		var err error
+		tenantConfigs, err = LoadTenants(conf.TenantsFile)
+		if err != nil {
+			return xerrors.Errorf("could not load tenants: %w", err)
+		}
+	}
+
+	tenants := make([]*Tenant, 0, len(tenantConfigs))
+	for _, tc := range tenantConfigs {
+		tenant, err := NewTenant(ctx, tc, conf)
+		if err != nil && tc.Name != "" {
+			return xerrors.Errorf("tenant %q: %w", tc.Name, err)
+		} else if err != nil {
+			return err
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	retryPolicy := stream.RetryPolicy{
+		MaxAttempts:    conf.HooksMaxAttempts,
+		InitialBackoff: conf.HooksInitialBackoff,
+		MaxBackoff:     conf.HooksMaxBackoff,
+		Multiplier:     stream.DefaultRetryPolicy.Multiplier,
+		Jitter:         stream.DefaultRetryPolicy.Jitter,
+	}
+
+	stream, err := stream.Open(stream.Options{
+		Dir:          conf.StreamDir,
+		SegmentSize:  conf.StreamSegmentSize,
+		Sync:         conf.StreamSync,
+		SyncInterval: conf.StreamSyncInterval,
+	})
+	if err != nil {
+		return xerrors.Errorf("could not open stream: %w", err)
+	}
+	defer stream.Stop()
 
 	if conf.StreamCompactInterval > 0 {
 		go func() {
@@ -74,32 +193,96 @@ func run(ctx context.Context, conf Config) error {
 		}()
 	}
 
-	httpClient := &http.Client{
-		Timeout: conf.GithubClientTimeout,
+	// every tenant has its own consumer groups, that process only tenant's messages
+	// and wait for the rate limit of tenant's GitHub client to reset
+	for _, tenant := range tenants {
+		issuesProcessor := &hooks.IssuesProcessor{
+			GithubService: tenant.GithubService,
+			Rules:         tenant.Rules,
+		}
+		err = stream.SubscribeN(githubIssuesTopic, tenantGroup(issuesProcessorGroup, tenant.Name), issuesProcessor, 2,
+			tenant.subscribeOptions(githubIssuesTopic, retryPolicy)...)
+		if err != nil {
+			return err
+		}
+
+		pullRequestsProcessor := &hooks.PullRequestsProcessor{
+			GithubService: tenant.GithubService,
+			Rules:         tenant.Rules,
+		}
+		err = stream.SubscribeN(githubPullRequestsTopic, tenantGroup(pullRequestsProcessorGroup, tenant.Name), pullRequestsProcessor, 1,
+			tenant.subscribeOptions(githubPullRequestsTopic, retryPolicy)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	rulesCtx, cancelRules := context.WithCancel(ctx)
+	defer cancelRules()
+
+	// reload the rules on SIGHUP, and when the rules file changes
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	defer signal.Stop(hups)
+	go func() {
+		for range hups {
+			for _, tenant := range tenants {
+				if err := tenant.Rules.Load(rulesCtx); err != nil {
+					log.Printf("failed to reload hooks rules of tenant %q, keeping version %d: %v\n", tenant.Name, tenant.Rules.Rules().Version, err)
+				}
+			}
+		}
+	}()
+	if conf.HooksRulesCheckInterval > 0 {
+		for _, tenant := range tenants {
+			go tenant.Rules.Watch(rulesCtx, conf.HooksRulesCheckInterval)
+		}
 	}
-	githubSvc := &githubsvc.Service{
-		Client: github.NewClient(conf.GithubAPIEndpoint, conf.GithubToken, graphql.WithHTTPClient(httpClient)),
+
+	var deliveriesPath string
+	if conf.StreamDir != "" {
+		deliveriesPath = filepath.Join(conf.StreamDir, deliveriesFile)
 	}
-	issuesProcessor := &hooks.IssuesProcessor{
-		GithubService: githubSvc,
+	deliveries, err := OpenDeliveryLog(deliveriesPath, conf.GithubDedupTTL, conf.GithubDedupSize)
+	if err != nil {
+		return xerrors.Errorf("could not open deliveries: %w", err)
 	}
-	stream.SubscribeN(githubIssuesTopic, issuesProcessor, 2)
+	defer deliveries.Close()
 
 	mux := http.NewServeMux()
 
-	githubHandler := NewGithubHandler(stream, conf.GithubSecret)
-	githubHandler.RegisterRoutes(mux)
+	for _, tenant := range tenants {
+		tenant.GithubHandler = NewGithubHandler(tenant.Name, stream, tenant.Verifier, deliveries)
+		tenant.GithubHandler.RegisterRoutes(mux)
+	}
 
-	server := http.Server{
-		Addr:    conf.Addr,
-		Handler: mux,
+	servers := []*http.Server{
+		{
+			Addr:    conf.Addr,
+			Handler: mux,
+		},
 	}
 
-	errc := make(chan error, 1)
-	go func() {
-		log.Printf("server is listening on %s\n", server.Addr)
-		errc <- server.ListenAndServe()
-	}()
+	if conf.AdminAddr != "" {
+		adminMux := http.NewServeMux()
+
+		adminHandler := NewAdminHandler(stream, deliveries, tenants)
+		adminHandler.RegisterRoutes(adminMux)
+		adminMux.Handle("/debug/vars", expvar.Handler())
+
+		servers = append(servers, &http.Server{
+			Addr:    conf.AdminAddr,
+			Handler: adminMux,
+		})
+	}
+
+	errc := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			log.Printf("server is listening on %s\n", server.Addr)
+			errc <- server.ListenAndServe()
+		}(server)
+	}
 
 	sigs := make(chan os.Signal, 2)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
@@ -116,5 +299,14 @@ func run(ctx context.Context, conf Config) error {
 	ctx, cancel := context.WithTimeout(ctx, conf.ExitTimeout)
 	defer cancel()
 
-	return server.Shutdown(ctx)
+	return shutdownServers(ctx, servers)
+}
+
+func shutdownServers(ctx context.Context, servers []*http.Server) (err error) {
+	for _, server := range servers {
+		if serr := server.Shutdown(ctx); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
 }
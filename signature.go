@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	ErrNoSignature       = xerrors.New("no signature")
+	ErrNoSHA256Signature = xerrors.New("no sha256 signature")
+)
+
+var (
+	// signatureSecretMatches counts verified deliveries by the tenant and the index of the secret,
+	// that matched the signature, e.g. "adjust/0"
+	signatureSecretMatches = expvar.NewMap("github_signature_secret_matches")
+	// signatureAlgoMatches counts verified deliveries by the signature's algorithm
+	signatureAlgoMatches = expvar.NewMap("github_signature_algo_matches")
+)
+
+// SignatureVerifier checks signatures of GitHub deliveries (see https://developer.github.com/webhooks/securing/).
+type SignatureVerifier struct {
+	// Tenant is the name of the tenant, the deliveries are verified for, in the metrics; it's "default" if it's empty.
+	Tenant string
+	// Secrets are the accepted secrets. A delivery is accepted, if any of the secrets verifies its signature,
+	// so a new secret can be added before the old one is retired. If there are no secrets, deliveries aren't verified.
+	Secrets []string
+	// RequireSHA256 makes deliveries without "X-Hub-Signature-256" header to be rejected.
+	RequireSHA256 bool
+}
+
+// ParseSecrets splits a comma-separated list of secrets.
+func ParseSecrets(s string) (secrets []string) {
+	for _, secret := range strings.Split(s, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// Verify checks the signature of the delivery's body. "X-Hub-Signature-256" header is preferred,
+// if it's present; legacy "X-Hub-Signature" is checked otherwise.
+func (v *SignatureVerifier) Verify(header http.Header, body []byte) error {
+	if len(v.Secrets) == 0 {
+		return nil
+	}
+
+	var (
+		algo    string
+		newHash func() hash.Hash
+		sig     string
+	)
+	if sig = header.Get("X-Hub-Signature-256"); sig != "" {
+		algo, newHash = "sha256", sha256.New
+	} else if v.RequireSHA256 {
+		return ErrNoSHA256Signature
+	} else if sig = header.Get("X-Hub-Signature"); sig != "" {
+		algo, newHash = "sha1", sha1.New
+	} else {
+		return ErrNoSignature
+	}
+
+	sum, err := hex.DecodeString(strings.TrimPrefix(sig, algo+"="))
+	if err != nil {
+		return xerrors.Errorf("could not decode signature %s: %w", sig, err)
+	}
+
+	for i, secret := range v.Secrets {
+		mac := hmac.New(newHash, []byte(secret))
+		mac.Write(body)
+		if hmac.Equal(mac.Sum(nil), sum) {
+			signatureSecretMatches.Add(v.metricsTenant()+"/"+strconv.Itoa(i), 1)
+			signatureAlgoMatches.Add(algo, 1)
+			return nil
+		}
+	}
+	return xerrors.Errorf("bad signature %s", sig)
+}
+
+func (v *SignatureVerifier) metricsTenant() string {
+	if v.Tenant == "" {
+		return "default"
+	}
+	return v.Tenant
+}
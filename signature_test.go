@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"hash"
+	"net/http"
+	"testing"
+)
+
+func TestSignatureVerifier_Verify(t *testing.T) {
+	body := []byte(`{"zen":"Keep it logically awesome."}`)
+
+	sha1New := "sha1=" + sign(sha1.New, "new", body)
+	sha256New := "sha256=" + sign(sha256.New, "new", body)
+	sha1Old := "sha1=" + sign(sha1.New, "old", body)
+	sha256Old := "sha256=" + sign(sha256.New, "old", body)
+
+	cases := []struct {
+		name    string
+		v       SignatureVerifier
+		headers map[string]string
+		wantErr bool
+	}{
+		{"no secrets", SignatureVerifier{}, nil, false},
+		{"no signature", SignatureVerifier{Secrets: []string{"new"}}, nil, true},
+		{"sha1", SignatureVerifier{Secrets: []string{"new"}}, map[string]string{"X-Hub-Signature": sha1New}, false},
+		{"sha256", SignatureVerifier{Secrets: []string{"new"}}, map[string]string{"X-Hub-Signature-256": sha256New}, false},
+		{"sha256 preferred", SignatureVerifier{Secrets: []string{"new"}}, map[string]string{"X-Hub-Signature": sha1New, "X-Hub-Signature-256": sha256New[:20]}, true},
+		{"sha256 required", SignatureVerifier{Secrets: []string{"new"}, RequireSHA256: true}, map[string]string{"X-Hub-Signature": sha1New}, true},
+		{"rotated secret", SignatureVerifier{Secrets: []string{"newer", "new"}}, map[string]string{"X-Hub-Signature-256": sha256New}, false},
+		{"retired secret", SignatureVerifier{Secrets: []string{"newer"}}, map[string]string{"X-Hub-Signature-256": sha256New}, true},
+		{"bad sha1", SignatureVerifier{Secrets: []string{"new"}}, map[string]string{"X-Hub-Signature": sha1Old}, true},
+		{"bad sha256", SignatureVerifier{Secrets: []string{"new"}}, map[string]string{"X-Hub-Signature-256": sha256Old}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := make(http.Header)
+			for k, v := range tc.headers {
+				header.Set(k, v)
+			}
+			err := tc.v.Verify(header, body)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("want error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifier_Verify_Metrics(t *testing.T) {
+	body := []byte(`{"zen":"Keep it logically awesome."}`)
+	header := make(http.Header)
+	header.Set("X-Hub-Signature-256", "sha256="+sign(sha256.New, "old", body))
+
+	matches := func(key string) int64 {
+		if v, ok := signatureSecretMatches.Get(key).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := matches("adjust/1")
+
+	v := SignatureVerifier{Tenant: "adjust", Secrets: []string{"new", "old"}}
+	if err := v.Verify(header, body); err != nil {
+		t.Fatal(err)
+	}
+	if got := matches("adjust/1") - before; got != 1 {
+		t.Errorf("want 1 match of tenant's secret 1, got %d", got)
+	}
+}
+
+func TestParseSecrets(t *testing.T) {
+	secrets := ParseSecrets(" new, old,,")
+	if len(secrets) != 2 || secrets[0] != "new" || secrets[1] != "old" {
+		t.Errorf("want [new old], got %q", secrets)
+	}
+}
+
+func sign(h func() hash.Hash, secret string, body []byte) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// HeaderRedriveGroup is the consumer group, that the message was redriven to from the dead-letter topic
+// (see Stream.Redrive). Other groups of the topic skip such messages.
+const HeaderRedriveGroup = "redrive-group"
+
+// Headers is the metadata of a message, e.g. the type of the event, that the message's data describes.
+// Headers are stored with the message, so processors and filters can use them without decoding message's data.
+type Headers map[string]string
+
+// Get returns the value of the header, or an empty string if there is no such header.
+func (h Headers) Get(key string) string {
+	return h[key]
+}
+
+func (h Headers) clone() Headers {
+	if len(h) == 0 {
+		return nil
+	}
+	c := make(Headers, len(h))
+	for k, v := range h {
+		c[k] = v
+	}
+	return c
+}
+
+func (h Headers) size() (n int64) {
+	for k, v := range h {
+		n += int64(len(k) + len(v))
+	}
+	return n
+}
+
+// marshalHeaders encodes headers as the number of headers followed by length-prefixed keys and values,
+// all lengths are uvarints. Keys are sorted, so equal headers are encoded the same way.
+func marshalHeaders(h Headers) []byte {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := make([]byte, 0, binary.MaxVarintLen64*(1+2*len(keys))+int(h.size()))
+	buf = appendUvarint(buf, uint64(len(keys)))
+	for _, k := range keys {
+		buf = appendUvarint(buf, uint64(len(k)))
+		buf = append(buf, k...)
+		buf = appendUvarint(buf, uint64(len(h[k])))
+		buf = append(buf, h[k]...)
+	}
+	return buf
+}
+
+func unmarshalHeaders(buf []byte) (Headers, error) {
+	n, buf, err := readUvarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	h := make(Headers)
+	for i := uint64(0); i < n; i++ {
+		var k, v []byte
+		if k, buf, err = readBytes(buf); err != nil {
+			return nil, err
+		}
+		if v, buf, err = readBytes(buf); err != nil {
+			return nil, err
+		}
+		h[string(k)] = string(v)
+	}
+	if len(buf) != 0 {
+		return nil, xerrors.New("trailing bytes after headers")
+	}
+	return h, nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func readUvarint(buf []byte) (uint64, []byte, error) {
+	v, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return 0, nil, xerrors.New("bad headers length")
+	}
+	return v, buf[n:], nil
+}
+
+func readBytes(buf []byte) ([]byte, []byte, error) {
+	n, buf, err := readUvarint(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n > uint64(len(buf)) {
+		return nil, nil, xerrors.New("bad header length")
+	}
+	return buf[:n], buf[n:], nil
+}
@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"time"
+)
+
+// Log is an append-only storage of topic's messages.
+// Implementations aren't required to be safe for concurrent use, Topic serialises the access.
+type Log interface {
+	// Append stores data with its headers at the end of the log and returns the offset assigned to it.
+	Append(data []byte, headers Headers) (offset int64, err error)
+
+	// Read returns the entry stored at offset. It returns false if offset isn't retained by the log.
+	Read(offset int64) (e Entry, ok bool, err error)
+
+	// Truncate removes messages up to and including offset.
+	Truncate(offset int64) error
+
+	// Bounds returns the offset of the first retained message and the offset the next message will get.
+	Bounds() (first, next int64)
+
+	// Size returns the number of bytes used by the log.
+	Size() int64
+
+	Close() error
+}
+
+// Entry is a message stored in the log.
+type Entry struct {
+	// Time is when the message was appended to the log.
+	Time    time.Time
+	Headers Headers
+	Data    []byte
+}
+
+func (e Entry) size() int64 {
+	return int64(len(e.Data)) + e.Headers.size()
+}
+
+// memLog is a Log that keeps messages in memory. Zero value is ready to use.
+type memLog struct {
+	entries []Entry
+	first   int64
+	size    int64
+}
+
+func (l *memLog) Append(data []byte, headers Headers) (offset int64, err error) {
+	e := Entry{
+		Time:    time.Now(),
+		Headers: headers.clone(),
+		Data:    data,
+	}
+	offset = l.first + int64(len(l.entries))
+	l.entries = append(l.entries, e)
+	l.size += e.size()
+	return offset, nil
+}
+
+func (l *memLog) Read(offset int64) (e Entry, ok bool, err error) {
+	if offset < l.first || offset >= l.first+int64(len(l.entries)) {
+		return Entry{}, false, nil
+	}
+	return l.entries[offset-l.first], true, nil
+}
+
+func (l *memLog) Truncate(offset int64) error {
+	if offset < l.first {
+		return nil
+	}
+	n := offset - l.first + 1
+	if n > int64(len(l.entries)) {
+		n = int64(len(l.entries))
+	}
+	for _, e := range l.entries[:n] {
+		l.size -= e.size()
+	}
+	l.entries = l.entries[n:]
+	l.first += n
+	return nil
+}
+
+func (l *memLog) Bounds() (first, next int64) {
+	return l.first, l.first + int64(len(l.entries))
+}
+
+func (l *memLog) Size() int64 {
+	return l.size
+}
+
+func (l *memLog) Close() error {
+	return nil
+}
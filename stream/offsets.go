@@ -0,0 +1,97 @@
+package stream
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// OffsetStore keeps offsets, committed by consumer groups, so groups resume reading where they stopped.
+// Committed offset is the offset of the next message the group will read.
+type OffsetStore interface {
+	Load(topic, group string) (offset int64, ok bool, err error)
+	Save(topic, group string, offset int64) error
+}
+
+// fileOffsetStore is an OffsetStore that keeps offsets of all topics in a single JSON file.
+type fileOffsetStore struct {
+	mu      sync.Mutex
+	path    string
+	sync    bool
+	offsets map[string]map[string]int64
+}
+
+func openFileOffsetStore(path string, sync bool) (*fileOffsetStore, error) {
+	store := &fileOffsetStore{
+		path:    path,
+		sync:    sync,
+		offsets: make(map[string]map[string]int64),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.offsets); err != nil {
+		return nil, xerrors.Errorf("could not decode offsets %s: %w", path, err)
+	}
+	return store, nil
+}
+
+func (store *fileOffsetStore) Load(topic, group string) (offset int64, ok bool, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	offset, ok = store.offsets[topic][group]
+	return offset, ok, nil
+}
+
+func (store *fileOffsetStore) Save(topic, group string, offset int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	groups := store.offsets[topic]
+	if groups == nil {
+		groups = make(map[string]int64)
+		store.offsets[topic] = groups
+	}
+	groups[group] = offset
+
+	data, err := json.Marshal(store.offsets)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.path, data, store.sync)
+}
+
+// writeFileAtomic replaces the file with data, so the readers never see the file partially written.
+func writeFileAtomic(path string, data []byte, sync bool) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
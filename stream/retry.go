@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultRetryPolicy is used by subscriptions, created without WithRetry option.
+var DefaultRetryPolicy = RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// RetryPolicy defines how messages, that failed to be processed, are delivered again.
+type RetryPolicy struct {
+	// MaxAttempts limits how many times a message is processed. Zero means no limit.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the message is delivered the second time.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between the attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor, by which the delay grows with every attempt.
+	Multiplier float64
+	// Jitter is the fraction of the delay, by which the delay is randomly changed.
+	Jitter float64
+}
+
+// Backoff returns the delay before the message is delivered again, after the attempt failed.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	mul := p.Multiplier
+	if mul < 1 {
+		mul = 1
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(mul, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+func (p RetryPolicy) exhausted(attempt int) bool {
+	return p.MaxAttempts > 0 && attempt >= p.MaxAttempts
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as the one, that won't go away if the message is processed again.
+// Messages, that failed with a permanent error, aren't retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsRetryable reports whether the message, that failed with err, is worth processing again.
+// Errors are retryable, unless they are marked with Permanent, or any error in the chain
+// implements Retryable() method, that returns false.
+func IsRetryable(err error) bool {
+	var perr *permanentError
+	if xerrors.As(err, &perr) {
+		return false
+	}
+	var rerr interface {
+		Retryable() bool
+	}
+	if xerrors.As(err, &rerr) {
+		return rerr.Retryable()
+	}
+	return true
+}
+
+// DeadLetter is a message, that failed to be processed, as it's pushed to the dead-letter topic.
+type DeadLetter struct {
+	Topic    string    `json:"topic"`
+	Group    string    `json:"group"`
+	Offset   int64     `json:"offset"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+	Headers  Headers   `json:"headers,omitempty"`
+	Data     []byte    `json:"data"`
+}
+
+// DeadLetterTopic returns the conventional name of the dead-letter topic for the topic.
+func DeadLetterTopic(key string) string {
+	return key + ".dlq"
+}
+
+type subscription struct {
+	retry      RetryPolicy
+	deadLetter string
+	filter     func(msg *Message) bool
+	throttle   func(ctx context.Context, msg *Message) error
+}
+
+type SubscribeOption func(sub *subscription)
+
+// WithRetry sets the policy to retry messages, that failed to be processed.
+func WithRetry(policy RetryPolicy) SubscribeOption {
+	return func(sub *subscription) {
+		sub.retry = policy
+	}
+}
+
+// WithDeadLetter makes messages, that failed permanently or ran out of attempts, to be pushed to the topic.
+// Without a dead-letter topic, such messages are dropped.
+func WithDeadLetter(key string) SubscribeOption {
+	return func(sub *subscription) {
+		sub.deadLetter = key
+	}
+}
+
+// WithFilter makes the subscription to process only the messages, for which filter returns true.
+// Other messages are acknowledged without processing.
+func WithFilter(filter func(msg *Message) bool) SubscribeOption {
+	return func(sub *subscription) {
+		sub.filter = filter
+	}
+}
+
+// WithThrottle makes subscription's workers to call wait before processing the message, so processing can be paused,
+// e.g. until the rate limit of an API, the processor calls for the message, resets. wait blocks until the message
+// may be processed; it returns an error only if ctx is done.
+func WithThrottle(wait func(ctx context.Context, msg *Message) error) SubscribeOption {
+	return func(sub *subscription) {
+		sub.throttle = wait
+	}
+}
@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, wantBackoff := range want {
+		if got := policy.Backoff(i + 1); got != wantBackoff {
+			t.Errorf("attempt %d: want %v, got %v", i+1, wantBackoff, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(2); got < time.Second || got > 3*time.Second {
+			t.Fatalf("with jitter: want backoff within [1s, 3s], got %v", got)
+		}
+	}
+}
+
+type retryableError bool
+
+func (e retryableError) Error() string {
+	return "retryable error"
+}
+
+func (e retryableError) Retryable() bool {
+	return bool(e)
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{xerrors.New("failed"), true},
+		{Permanent(xerrors.New("failed")), false},
+		{xerrors.Errorf("wrapped: %w", Permanent(xerrors.New("failed"))), false},
+		{xerrors.Errorf("wrapped: %w", retryableError(true)), true},
+		{xerrors.Errorf("wrapped: %w", retryableError(false)), false},
+	}
+	for _, tc := range cases {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("IsRetryable(%v): want %v, got %v", tc.err, tc.want, got)
+		}
+	}
+}
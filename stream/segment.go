@@ -0,0 +1,506 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Segment file starts with a header, made of segmentMagic followed by a version byte,
+// and continues with records. A record is
+//
+//	length (uint32) | crc32 of body (uint32) | body
+//
+// where body is a receive time (unix nanoseconds, int64), followed by the length of encoded headers (uint32),
+// the headers (see marshalHeaders) and message data. Version 1 segments have no headers in the body;
+// they are still read, but new messages are appended to segments of the current version only.
+const (
+	segmentExt     = ".seg"
+	segmentMagic   = "hookeye"
+	segmentVersion = 2
+
+	segmentHeaderSize = len(segmentMagic) + 1
+	recordHeaderSize  = 8
+	recordTimeSize    = 8
+	recordHeadersSize = 4
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorruptRecord = xerrors.New("corrupt record")
+
+type segment struct {
+	// offset of the first record in the segment
+	base    int64
+	version byte
+	file    *os.File
+	// size of the file, including the header
+	size int64
+	// position of every record in the file
+	positions []int64
+}
+
+func (seg *segment) next() int64 {
+	return seg.base + int64(len(seg.positions))
+}
+
+func segmentPath(dir string, base int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", base, segmentExt))
+}
+
+func createSegment(dir string, base int64) (*segment, error) {
+	f, err := os.OpenFile(segmentPath(dir, base), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	seg := &segment{
+		base: base,
+		file: f,
+	}
+	if err := seg.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := syncDir(dir); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return seg, nil
+}
+
+// openSegment opens existing segment file and loads its records' positions.
+// If repair is true, a torn or corrupt tail of the segment, left by a crash in the middle of a write, is truncated.
+func openSegment(path string, base int64, repair bool) (*segment, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	seg := &segment{
+		base: base,
+		file: f,
+	}
+	if err := seg.load(repair); err != nil {
+		f.Close()
+		return nil, xerrors.Errorf("could not load segment %s: %w", path, err)
+	}
+	return seg, nil
+}
+
+func (seg *segment) writeHeader() error {
+	header := make([]byte, segmentHeaderSize)
+	copy(header, segmentMagic)
+	header[len(segmentMagic)] = segmentVersion
+
+	if _, err := seg.file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	seg.version = segmentVersion
+	seg.size = int64(segmentHeaderSize)
+
+	return seg.file.Sync()
+}
+
+func (seg *segment) load(repair bool) error {
+	info, err := seg.file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+
+	r := bufio.NewReader(io.NewSectionReader(seg.file, 0, fileSize))
+
+	header := make([]byte, segmentHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if repair && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			log.Printf("stream: rewriting incomplete header of segment %s\n", seg.file.Name())
+			if err := seg.file.Truncate(0); err != nil {
+				return err
+			}
+			return seg.writeHeader()
+		}
+		return err
+	}
+	if string(header[:len(segmentMagic)]) != segmentMagic {
+		return xerrors.New("bad segment header")
+	}
+	seg.version = header[len(segmentMagic)]
+	if seg.version < 1 || seg.version > segmentVersion {
+		return xerrors.Errorf("unsupported segment version %d", seg.version)
+	}
+
+	pos := int64(segmentHeaderSize)
+	hdr := make([]byte, recordHeaderSize)
+	for {
+		_, err := io.ReadFull(r, hdr)
+		if err == io.EOF {
+			break
+		}
+
+		var length int64
+		if err == nil {
+			length = int64(binary.BigEndian.Uint32(hdr[0:4]))
+			if length < recordTimeSize || length > fileSize-pos-recordHeaderSize {
+				err = errCorruptRecord
+			} else {
+				body := make([]byte, length)
+				_, err = io.ReadFull(r, body)
+				if err == nil && crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(hdr[4:8]) {
+					err = errCorruptRecord
+				}
+			}
+		}
+		if err != nil {
+			if !repair {
+				return xerrors.Errorf("bad record at position %d: %w", pos, err)
+			}
+			log.Printf("stream: truncating segment %s at position %d: %v\n", seg.file.Name(), pos, err)
+			if err := seg.file.Truncate(pos); err != nil {
+				return err
+			}
+			break
+		}
+
+		seg.positions = append(seg.positions, pos)
+		pos += recordHeaderSize + length
+	}
+
+	seg.size = pos
+
+	return nil
+}
+
+// encodeRecord returns the record of the current segment version.
+func encodeRecord(t time.Time, headers Headers, data []byte) []byte {
+	hdrs := marshalHeaders(headers)
+
+	buf := make([]byte, recordHeaderSize+recordTimeSize+recordHeadersSize+len(hdrs)+len(data))
+	body := buf[recordHeaderSize:]
+	binary.BigEndian.PutUint64(body[0:8], uint64(t.UnixNano()))
+	binary.BigEndian.PutUint32(body[8:12], uint32(len(hdrs)))
+	copy(body[12:], hdrs)
+	copy(body[12+len(hdrs):], data)
+
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(body, crcTable))
+	return buf
+}
+
+// decodeRecordBody decodes the body of the record, written to a segment of the version.
+func decodeRecordBody(version byte, body []byte) (Entry, error) {
+	if len(body) < recordTimeSize {
+		return Entry{}, errCorruptRecord
+	}
+	e := Entry{
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(body[:recordTimeSize]))),
+	}
+	body = body[recordTimeSize:]
+
+	if version >= 2 {
+		if len(body) < recordHeadersSize {
+			return Entry{}, errCorruptRecord
+		}
+		n := int64(binary.BigEndian.Uint32(body[:recordHeadersSize]))
+		body = body[recordHeadersSize:]
+		if n > int64(len(body)) {
+			return Entry{}, errCorruptRecord
+		}
+		headers, err := unmarshalHeaders(body[:n])
+		if err != nil {
+			return Entry{}, xerrors.Errorf("%v: %w", err, errCorruptRecord)
+		}
+		e.Headers = headers
+		body = body[n:]
+	}
+
+	e.Data = body
+	return e, nil
+}
+
+// append writes the encoded record at the end of the segment.
+func (seg *segment) append(buf []byte) error {
+	if _, err := seg.file.WriteAt(buf, seg.size); err != nil {
+		// drop partially written record, so it isn't read back after restart
+		seg.file.Truncate(seg.size)
+		return err
+	}
+
+	seg.positions = append(seg.positions, seg.size)
+	seg.size += int64(len(buf))
+
+	return nil
+}
+
+// dropLast removes the last record from the segment.
+func (seg *segment) dropLast() error {
+	n := len(seg.positions) - 1
+	if err := seg.file.Truncate(seg.positions[n]); err != nil {
+		return err
+	}
+	seg.size = seg.positions[n]
+	seg.positions = seg.positions[:n]
+	return nil
+}
+
+func (seg *segment) read(offset int64) (Entry, error) {
+	pos := seg.positions[offset-seg.base]
+
+	hdr := make([]byte, recordHeaderSize)
+	if _, err := seg.file.ReadAt(hdr, pos); err != nil {
+		return Entry{}, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(hdr[0:4]))
+	if _, err := seg.file.ReadAt(body, pos+recordHeaderSize); err != nil {
+		return Entry{}, err
+	}
+
+	return decodeRecordBody(seg.version, body)
+}
+
+func (seg *segment) remove() error {
+	if err := os.Remove(seg.file.Name()); err != nil {
+		return err
+	}
+	return seg.file.Close()
+}
+
+// fileLog is a Log that stores messages in a directory of append-only segment files.
+// The last segment is the active one, new messages are appended to it until it grows over the segment size.
+type fileLog struct {
+	dir  string
+	opts Options
+
+	segments []*segment
+	// first retained offset; messages below it can still be on disk, until their segment is removed
+	first int64
+
+	lastSync time.Time
+	// syncFile flushes segment's file to disk; tests replace it to inject failures
+	syncFile func(*os.File) error
+}
+
+func openFileLog(dir string, opts Options) (*fileLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	bases, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &fileLog{
+		dir:      dir,
+		opts:     opts,
+		syncFile: (*os.File).Sync,
+	}
+
+	for i, base := range bases {
+		seg, err := openSegment(segmentPath(dir, base), base, i == len(bases)-1)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		if n := len(l.segments); n > 0 && l.segments[n-1].next() != base {
+			seg.file.Close()
+			l.Close()
+			return nil, xerrors.Errorf("segment %s: want base offset %d, got %d", seg.file.Name(), l.segments[n-1].next(), base)
+		}
+		l.segments = append(l.segments, seg)
+	}
+
+	if len(l.segments) == 0 {
+		seg, err := createSegment(dir, 0)
+		if err != nil {
+			return nil, err
+		}
+		l.segments = append(l.segments, seg)
+	}
+
+	l.first = l.segments[0].base
+	l.lastSync = time.Now()
+
+	return l, nil
+}
+
+func listSegments(dir string) ([]int64, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+
+	bases := make([]int64, 0, len(names))
+	for _, name := range names {
+		base, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("bad segment name %s: %w", name, err)
+		}
+		bases = append(bases, base)
+	}
+
+	sort.Slice(bases, func(i, j int) bool {
+		return bases[i] < bases[j]
+	})
+
+	return bases, nil
+}
+
+func (l *fileLog) active() *segment {
+	return l.segments[len(l.segments)-1]
+}
+
+func (l *fileLog) Append(data []byte, headers Headers) (offset int64, err error) {
+	buf := encodeRecord(time.Now(), headers, data)
+
+	seg := l.active()
+	if seg.version != segmentVersion && len(seg.positions) == 0 {
+		// empty segment of older version, left from before the upgrade, is simply rewritten
+		if err := seg.file.Truncate(0); err != nil {
+			return 0, err
+		}
+		if err := seg.writeHeader(); err != nil {
+			return 0, err
+		}
+	}
+	if len(seg.positions) > 0 && (seg.version != segmentVersion || seg.size+int64(len(buf)) > l.opts.SegmentSize) {
+		seg, err = l.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	offset = seg.next()
+	if err := seg.append(buf); err != nil {
+		return 0, err
+	}
+
+	if err := l.sync(seg); err != nil {
+		// the record is dropped, as the message isn't published: an offset, that no group is pushed,
+		// would hold the groups' commits forever
+		if derr := seg.dropLast(); derr != nil {
+			// the record stays in the log, so it's published, even though it can be lost on crash
+			log.Printf("stream: failed to sync segment %s: %v; could not drop the record: %v\n", seg.file.Name(), err, derr)
+			return offset, nil
+		}
+		return 0, xerrors.Errorf("could not sync segment: %w", err)
+	}
+
+	return offset, nil
+}
+
+func (l *fileLog) rotate() (*segment, error) {
+	if err := l.syncFile(l.active().file); err != nil {
+		return nil, err
+	}
+
+	seg, err := createSegment(l.dir, l.active().next())
+	if err != nil {
+		return nil, xerrors.Errorf("could not rotate segment: %w", err)
+	}
+	l.segments = append(l.segments, seg)
+
+	return seg, nil
+}
+
+func (l *fileLog) sync(seg *segment) error {
+	switch l.opts.Sync {
+	case SyncAlways:
+		return l.syncFile(seg.file)
+	case SyncInterval:
+		if now := time.Now(); now.Sub(l.lastSync) >= l.opts.SyncInterval {
+			l.lastSync = now
+			return l.syncFile(seg.file)
+		}
+	}
+	return nil
+}
+
+func (l *fileLog) Read(offset int64) (e Entry, ok bool, err error) {
+	if offset < l.first {
+		return Entry{}, false, nil
+	}
+
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].next() > offset
+	})
+	if i == len(l.segments) {
+		return Entry{}, false, nil
+	}
+
+	e, err = l.segments[i].read(offset)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return e, true, nil
+}
+
+// Truncate hides messages up to and including offset, and removes the segments, all messages of which are truncated.
+// The active segment is never removed.
+func (l *fileLog) Truncate(offset int64) error {
+	if offset < l.first {
+		return nil
+	}
+	if next := l.active().next(); offset >= next {
+		offset = next - 1
+	}
+	l.first = offset + 1
+
+	var n int
+	for n < len(l.segments)-1 && l.segments[n].next() <= l.first {
+		n++
+	}
+	for i, seg := range l.segments[:n] {
+		if err := seg.remove(); err != nil {
+			l.segments = l.segments[i:]
+			return xerrors.Errorf("could not remove segment: %w", err)
+		}
+	}
+	l.segments = l.segments[n:]
+
+	return nil
+}
+
+func (l *fileLog) Bounds() (first, next int64) {
+	return l.first, l.active().next()
+}
+
+// Size returns the size of log's segment files, including the truncated messages, which segments aren't removed yet.
+func (l *fileLog) Size() (size int64) {
+	for _, seg := range l.segments {
+		size += seg.size
+	}
+	return size
+}
+
+func (l *fileLog) Close() (err error) {
+	if len(l.segments) > 0 {
+		err = l.active().file.Sync()
+	}
+	for _, seg := range l.segments {
+		if cerr := seg.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
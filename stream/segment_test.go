@@ -0,0 +1,300 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestFileLog_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hookeye-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Options{SegmentSize: 64}
+
+	l, err := openFileLog(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		offset, err := l.Append(bytes.Repeat([]byte{byte('A' + i)}, 10), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != int64(i) {
+			t.Errorf("append %d: want offset %v, got %v", i, i, offset)
+		}
+	}
+	if len(l.segments) < 2 {
+		t.Errorf("want segments to rotate, got %d segments", len(l.segments))
+	}
+	assertNoError(t, l.Close())
+
+	l, err = openFileLog(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if first, next := l.Bounds(); first != 0 || next != 10 {
+		t.Errorf("bounds: want [0, 10), got [%d, %d)", first, next)
+	}
+	for i := 0; i < 10; i++ {
+		assertLogRead(t, l, int64(i), bytes.Repeat([]byte{byte('A' + i)}, 10))
+	}
+
+	offset, err := l.Append([]byte{'x'}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 10 {
+		t.Errorf("append after reopen: want offset 10, got %v", offset)
+	}
+}
+
+func TestFileLog_Truncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hookeye-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// every segment fits two records
+	recordSize := len(encodeRecord(time.Now(), nil, []byte{'A'}))
+	l, err := openFileLog(dir, Options{SegmentSize: int64(segmentHeaderSize + 2*recordSize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := l.Append([]byte{byte('A' + i)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertNoError(t, l.Truncate(2)) // truncate up to 'C'
+
+	if _, ok, _ := l.Read(2); ok {
+		t.Errorf("offset 2: want to not exist, got %v", ok)
+	}
+	assertLogRead(t, l, 3, []byte{'D'})
+
+	// segment with 'A' and 'B' must be removed, while segment with 'C' and 'D' must be kept
+	bases, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []int64{2, 4}, bases; !equalOffsets(want, got) {
+		t.Errorf("segments: want %v, got %v", want, got)
+	}
+
+	// truncating everything keeps the active segment
+	assertNoError(t, l.Truncate(10))
+
+	bases, err = listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []int64{4}, bases; !equalOffsets(want, got) {
+		t.Errorf("segments: want %v, got %v", want, got)
+	}
+	if first, next := l.Bounds(); first != 5 || next != 5 {
+		t.Errorf("bounds: want [5, 5), got [%d, %d)", first, next)
+	}
+}
+
+func TestFileLog_RecoverTornWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hookeye-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := openFileLog(dir, Options{SegmentSize: DefaultSegmentSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := l.Append([]byte{byte('A' + i)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertNoError(t, l.Close())
+
+	// simulate a crash in the middle of writing the last record
+	path := segmentPath(dir, 0)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoError(t, os.Truncate(path, info.Size()-3))
+
+	l, err = openFileLog(dir, Options{SegmentSize: DefaultSegmentSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if first, next := l.Bounds(); first != 0 || next != 2 {
+		t.Errorf("bounds: want [0, 2), got [%d, %d)", first, next)
+	}
+	assertLogRead(t, l, 1, []byte{'B'})
+
+	offset, err := l.Append([]byte{'x'}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 2 {
+		t.Errorf("append after recovery: want offset 2, got %v", offset)
+	}
+	assertLogRead(t, l, 2, []byte{'x'})
+}
+
+func TestFileLog_SyncError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hookeye-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := openFileLog(dir, Options{SegmentSize: DefaultSegmentSize, Sync: SyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Append([]byte{'A'}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the record, that failed to sync, is dropped
+	l.syncFile = func(*os.File) error {
+		return xerrors.New("disk is gone")
+	}
+	if _, err := l.Append([]byte{'B'}, nil); err == nil {
+		t.Fatal("want sync error")
+	}
+	if first, next := l.Bounds(); first != 0 || next != 1 {
+		t.Errorf("bounds after sync error: want [0, 1), got [%d, %d)", first, next)
+	}
+
+	l.syncFile = (*os.File).Sync
+	offset, err := l.Append([]byte{'C'}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 1 {
+		t.Errorf("append after sync error: want offset 1, got %v", offset)
+	}
+	assertNoError(t, l.Close())
+
+	l, err = openFileLog(dir, Options{SegmentSize: DefaultSegmentSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if first, next := l.Bounds(); first != 0 || next != 2 {
+		t.Errorf("bounds after reopen: want [0, 2), got [%d, %d)", first, next)
+	}
+	assertLogRead(t, l, 0, []byte{'A'})
+	assertLogRead(t, l, 1, []byte{'C'})
+}
+
+func TestFileLog_Headers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hookeye-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// write a version 1 segment, as it was written before the headers were added
+	v1 := []byte(segmentMagic + "\x01")
+	for _, data := range []string{"A", "B"} {
+		body := make([]byte, recordTimeSize+len(data))
+		binary.BigEndian.PutUint64(body, uint64(time.Now().UnixNano()))
+		copy(body[recordTimeSize:], data)
+
+		hdr := make([]byte, recordHeaderSize)
+		binary.BigEndian.PutUint32(hdr[0:4], uint32(len(body)))
+		binary.BigEndian.PutUint32(hdr[4:8], crc32.Checksum(body, crcTable))
+		v1 = append(append(v1, hdr...), body...)
+	}
+	assertNoError(t, ioutil.WriteFile(segmentPath(dir, 0), v1, 0644))
+
+	l, err := openFileLog(dir, Options{SegmentSize: DefaultSegmentSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLogRead(t, l, 1, []byte{'B'})
+
+	headers := Headers{"event": "issues", "action": "opened"}
+	offset, err := l.Append([]byte{'C'}, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 2 {
+		t.Errorf("append: want offset 2, got %v", offset)
+	}
+	// new records are never appended to a version 1 segment
+	if len(l.segments) != 2 {
+		t.Errorf("want segment to rotate, got %d segments", len(l.segments))
+	}
+	assertNoError(t, l.Close())
+
+	l, err = openFileLog(dir, Options{SegmentSize: DefaultSegmentSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	e, _, err := l.Read(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Headers != nil || string(e.Data) != "A" {
+		t.Errorf("offset 0: want no headers and data A, got %v %q", e.Headers, e.Data)
+	}
+	e, _, err = l.Read(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(headers, e.Headers) || string(e.Data) != "C" {
+		t.Errorf("offset 2: want %v and data C, got %v %q", headers, e.Headers, e.Data)
+	}
+}
+
+func assertLogRead(t *testing.T, l Log, offset int64, want []byte) {
+	t.Helper()
+
+	e, ok, err := l.Read(offset)
+	if err != nil {
+		t.Fatalf("offset %d: %v", offset, err)
+	}
+	if !ok {
+		t.Errorf("offset %d: want to exist, got %v", offset, ok)
+	} else if !bytes.Equal(want, e.Data) {
+		t.Errorf("offset %d: want %v, got %v", offset, want, e.Data)
+	}
+}
+
+func equalOffsets(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,10 +2,18 @@ package stream
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/url"
+	"os"
+	"path/filepath"
 	"sort"
 	"sync"
 	"time"
+
+	"golang.org/x/xerrors"
 )
 
 type Processor interface {
@@ -20,21 +28,112 @@ func (p ProcessorFunc) Process(ctx context.Context, msg *Message) error {
 
 type Message struct {
 	Offset int64
-	Data   []byte
+	// Time is when the message was pushed to the topic.
+	Time    time.Time
+	Headers Headers
+	Data    []byte
+	// Attempt is the number of times the message was delivered to the group, including this one.
+	Attempt int
+
+	group      *Group
+	generation int
+	once       sync.Once
+}
+
+// Ack marks the message as processed. Only the first call to Ack or Nack takes effect.
+// Messages, that the processor neither acks nor nacks, are acked, if processing succeeds, and nacked otherwise.
+func (msg *Message) Ack() {
+	msg.once.Do(func() {
+		msg.group.ack(msg.Offset, msg.generation)
+	})
+}
+
+// Nack returns the message to its group to be delivered again.
+func (msg *Message) Nack() {
+	msg.once.Do(func() {
+		msg.group.nack(msg.Offset, msg.generation)
+	})
+}
 
-	group *Group
+func (msg *Message) retryAfter(d time.Duration) {
+	msg.once.Do(func() {
+		time.AfterFunc(d, func() {
+			msg.group.nack(msg.Offset, msg.generation)
+		})
+	})
+}
+
+// ErrNotFound is returned when the requested topic, group or message doesn't exist.
+var ErrNotFound = xerrors.New("not found")
+
+// offsetsFile is the name of the file in Options.Dir, where offsets committed by consumer groups are stored.
+const offsetsFile = "offsets.json"
+
+// DefaultSegmentSize is the size of a topic's log segment, used when Options.SegmentSize isn't set.
+const DefaultSegmentSize = 64 << 20
+
+// SyncPolicy defines how often topics' logs are flushed to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways flushes the log after every pushed message.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval flushes the log on the first push after Options.SyncInterval passed since the previous flush.
+	SyncInterval
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncInterval:
+		return "interval"
+	case SyncNever:
+		return "never"
+	}
+	return fmt.Sprintf("SyncPolicy(%d)", int(p))
+}
+
+// Set implements flag.Value.
+func (p *SyncPolicy) Set(s string) error {
+	switch s {
+	case "always":
+		*p = SyncAlways
+	case "interval":
+		*p = SyncInterval
+	case "never":
+		*p = SyncNever
+	default:
+		return xerrors.Errorf("unknown sync policy %q", s)
+	}
+	return nil
+}
+
+type Options struct {
+	// Dir is the directory, where topics' logs are stored. Topics are kept in memory if Dir is empty.
+	Dir string
+
+	SegmentSize  int64
+	Sync         SyncPolicy
+	SyncInterval time.Duration
 }
 
 type Stream struct {
 	mu     sync.RWMutex
 	topics map[string]*Topic
 
+	opts        Options
+	offsetStore OffsetStore
+
 	compactInterval time.Duration
 
 	wg   sync.WaitGroup
 	done chan struct{}
 }
 
+// New creates a stream, that keeps topics in memory.
 func New() *Stream {
 	return &Stream{
 		topics: make(map[string]*Topic),
@@ -42,51 +141,159 @@ func New() *Stream {
 	}
 }
 
-func (stream *Stream) SubscribeN(key string, p Processor, n int) {
+// Open creates a stream, that persists topics in opts.Dir, and recovers topics, stored there previously.
+func Open(opts Options) (*Stream, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+
+	stream := New()
+	stream.opts = opts
+
+	if opts.Dir == "" {
+		return stream, nil
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	offsetStore, err := openFileOffsetStore(filepath.Join(opts.Dir, offsetsFile), opts.Sync != SyncNever)
+	if err != nil {
+		return nil, err
+	}
+	stream.offsetStore = offsetStore
+
+	dirs, err := ioutil.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		key, err := url.PathUnescape(dir.Name())
+		if err != nil {
+			stream.Stop()
+			return nil, xerrors.Errorf("bad topic directory %q: %w", dir.Name(), err)
+		}
+		if _, err := stream.topic(key); err != nil {
+			stream.Stop()
+			return nil, err
+		}
+	}
+
+	return stream, nil
+}
+
+// topic returns the topic by key, creating it if it doesn't exist.
+func (stream *Stream) topic(key string) (*Topic, error) {
+	stream.mu.RLock()
+	topic, ok := stream.topics[key]
+	stream.mu.RUnlock()
+
+	if ok {
+		return topic, nil
+	}
+
 	stream.mu.Lock()
 	defer stream.mu.Unlock()
 
-	topic, ok := stream.topics[key]
-	if !ok {
-		topic = &Topic{}
-		stream.topics[key] = topic
+	topic, ok = stream.topics[key]
+	if ok {
+		return topic, nil
 	}
 
-	group := topic.NewGroup()
+	if stream.opts.Dir == "" {
+		topic = newTopic(key, nil, nil)
+	} else {
+		log, err := openFileLog(filepath.Join(stream.opts.Dir, url.PathEscape(key)), stream.opts)
+		if err != nil {
+			return nil, xerrors.Errorf("could not open topic %q: %w", key, err)
+		}
+		topic = newTopic(key, log, stream.offsetStore)
+	}
+	stream.topics[key] = topic
+
+	return topic, nil
+}
+
+// SubscribeN starts n workers, that read messages of the topic as a consumer group with the name.
+// Group's committed offset is kept across restarts, if the stream is persisted.
+func (stream *Stream) SubscribeN(key, name string, p Processor, n int, opts ...SubscribeOption) error {
+	sub := &subscription{
+		retry: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(sub)
+	}
+
+	topic, err := stream.topic(key)
+	if err != nil {
+		return err
+	}
+
+	group, err := topic.Group(name)
+	if err != nil {
+		return err
+	}
 
 	stream.wg.Add(n)
 	for ; n > 0; n-- {
 		go func() {
-			readGroup(group, p, stream.done)
+			stream.readGroup(group, p, sub)
 			stream.wg.Done()
 		}()
 	}
+
+	return nil
 }
 
-func (stream *Stream) Stop() error {
+// Stop waits for subscribers to exit and closes topics.
+func (stream *Stream) Stop() (err error) {
 	close(stream.done)
 	stream.wg.Wait()
-	return nil
+
+	stream.mu.RLock()
+	defer stream.mu.RUnlock()
+
+	for key, topic := range stream.topics {
+		if cerr := topic.Close(); cerr != nil {
+			log.Printf("stream: failed to close topic %q: %v\n", key, cerr)
+			if err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
 }
 
-func readGroup(group *Group, p Processor, done <-chan struct{}) {
+func (stream *Stream) readGroup(group *Group, p Processor, sub *subscription) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go func() {
-		<-done
+		<-stream.done
 		cancel()
 	}()
 
 	for {
-		offset, data, err := group.Pop(ctx)
-		if err == nil {
-			msg := &Message{
-				Offset: offset,
-				Data:   data,
-				group:  group,
+		msg, err := group.pop(ctx)
+		if err == nil && (!isForGroup(msg, group) || sub.filter != nil && !sub.filter(msg)) {
+			msg.Ack()
+		} else if err == nil {
+			if sub.throttle != nil {
+				if err := sub.throttle(ctx, msg); err != nil {
+					// the stream is stopped; the message isn't acknowledged, so it's processed after restart
+					return
+				}
 			}
 			err = p.Process(ctx, msg)
+			if err != nil {
+				stream.handleFailure(ctx, group, sub, msg, err)
+			} else {
+				msg.Ack()
+			}
 		}
 
 		select {
@@ -101,25 +308,96 @@ func readGroup(group *Group, p Processor, done <-chan struct{}) {
 	}
 }
 
+// isForGroup reports whether the group processes the message: messages, redriven from the dead-letter topic,
+// are processed only by the group, that failed them.
+func isForGroup(msg *Message, group *Group) bool {
+	name := msg.Headers.Get(HeaderRedriveGroup)
+	return name == "" || name == group.name
+}
+
+// handleFailure schedules the failed message to be delivered again, according to subscription's retry policy.
+// Messages, that can't be retried, are moved to the dead-letter topic, if the subscription has one.
+func (stream *Stream) handleFailure(ctx context.Context, group *Group, sub *subscription, msg *Message, err error) {
+	if ctx.Err() != nil {
+		// stream is stopping; message is delivered again, as it isn't acknowledged
+		return
+	}
+
+	if IsRetryable(err) && !sub.retry.exhausted(msg.Attempt) {
+		msg.retryAfter(sub.retry.Backoff(msg.Attempt))
+		return
+	}
+
+	if sub.deadLetter == "" {
+		log.Printf("stream: dropping message %d from group %s after %d attempts: %v\n", msg.Offset, group, msg.Attempt, err)
+		msg.Ack()
+		return
+	}
+
+	dl := DeadLetter{
+		Topic:    group.topic.key,
+		Group:    group.name,
+		Offset:   msg.Offset,
+		Attempts: msg.Attempt,
+		Error:    err.Error(),
+		FailedAt: time.Now(),
+		Headers:  msg.Headers,
+		Data:     msg.Data,
+	}
+	data, err := json.Marshal(dl)
+	if err == nil {
+		err = stream.Push(ctx, sub.deadLetter, data)
+	}
+	if err != nil {
+		log.Printf("stream: failed to push message %d from group %s to dead-letter topic %q: %v\n", msg.Offset, group, sub.deadLetter, err)
+		msg.retryAfter(sub.retry.Backoff(msg.Attempt))
+		return
+	}
+	msg.Ack()
+}
+
 func (stream *Stream) Push(ctx context.Context, key string, data []byte) error {
+	_, err := stream.Publish(ctx, key, data, nil)
+	return err
+}
+
+// Publish is like Push, but it stores the headers with the message and returns the offset assigned to the message.
+func (stream *Stream) Publish(ctx context.Context, key string, data []byte, headers Headers) (offset int64, err error) {
+	topic, err := stream.topic(key)
+	if err != nil {
+		return 0, err
+	}
+	return topic.Publish(ctx, data, headers)
+}
+
+// Topics returns sorted keys of stream's topics.
+func (stream *Stream) Topics() []string {
 	stream.mu.RLock()
-	topic, ok := stream.topics[key]
+	keys := make([]string, 0, len(stream.topics))
+	for key := range stream.topics {
+		keys = append(keys, key)
+	}
 	stream.mu.RUnlock()
 
-	if !ok {
-		stream.mu.Lock()
-		topic, ok = stream.topics[key]
-		if !ok {
-			topic = &Topic{}
-			stream.topics[key] = topic
-		}
-		stream.mu.Unlock()
+	sort.Strings(keys)
+
+	return keys
+}
+
+// HasSubscribers reports whether the topic has any consumer group.
+func (stream *Stream) HasSubscribers(key string) bool {
+	topic := stream.Topic(key)
+	if topic == nil {
+		return false
 	}
 
-	return topic.Push(ctx, data)
+	topic.groupsMu.RLock()
+	defer topic.groupsMu.RUnlock()
+
+	return len(topic.groups) > 0
 }
 
-// test only
+// Topic returns the topic by key, or nil if the topic doesn't exist.
 func (stream *Stream) Topic(key string) *Topic {
 	stream.mu.RLock()
 	topic := stream.topics[key]
@@ -127,6 +405,65 @@ func (stream *Stream) Topic(key string) *Topic {
 	return topic
 }
 
+// ResetGroup resets group's committed offset of the topic (see Topic.ResetGroup).
+func (stream *Stream) ResetGroup(key, name string, offset int64) (int64, error) {
+	topic := stream.Topic(key)
+	if topic == nil {
+		return 0, xerrors.Errorf("topic %q: %w", key, ErrNotFound)
+	}
+	return topic.ResetGroup(name, offset)
+}
+
+// ResetGroupTime resets group's committed offset of the topic to the first message pushed at or after t.
+func (stream *Stream) ResetGroupTime(key, name string, t time.Time) (int64, error) {
+	topic := stream.Topic(key)
+	if topic == nil {
+		return 0, xerrors.Errorf("topic %q: %w", key, ErrNotFound)
+	}
+	offset, err := topic.OffsetAt(t)
+	if err != nil {
+		return 0, err
+	}
+	return topic.ResetGroup(name, offset)
+}
+
+// Redrive pushes the message, stored in the dead-letter topic at offset, back to the topic it came from.
+// The message is marked with HeaderRedriveGroup, so only the group, that failed the message, processes it again.
+// Redrive isn't idempotent: the message is pushed again, every time it's redriven.
+func (stream *Stream) Redrive(ctx context.Context, key string, offset int64) (*DeadLetter, error) {
+	topic := stream.Topic(key)
+	if topic == nil {
+		return nil, xerrors.Errorf("topic %q: %w", key, ErrNotFound)
+	}
+
+	e, ok, err := topic.Read(offset)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, xerrors.Errorf("offset %d: %w", offset, ErrNotFound)
+	}
+
+	var dl DeadLetter
+	if err := json.Unmarshal(e.Data, &dl); err != nil {
+		return nil, xerrors.Errorf("could not decode dead letter at offset %d: %w", offset, err)
+	}
+	if dl.Topic == "" {
+		return nil, xerrors.Errorf("dead letter at offset %d has no topic", offset)
+	}
+
+	headers := dl.Headers.clone()
+	if dl.Group != "" {
+		if headers == nil {
+			headers = make(Headers)
+		}
+		headers[HeaderRedriveGroup] = dl.Group
+	}
+	if _, err := stream.Publish(ctx, dl.Topic, dl.Data, headers); err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
 func (stream *Stream) Compact() {
 	stream.mu.RLock()
 	for key, topic := range stream.topics {
@@ -137,12 +474,23 @@ func (stream *Stream) Compact() {
 
 func compactTopic(key string, topic *Topic) {
 	offsets := topic.Offsets()
+	if len(offsets) == 0 {
+		// keep messages until there is a group to read them
+		return
+	}
 
 	sort.Slice(offsets, func(i, j int) bool {
 		return offsets[i] < offsets[j]
 	})
 
-	//log.Printf("stream(debug): truncate topic %q to offset %d: %v\n", key, offsets[0], topic)
+	// committed offset is the next one to read, so every group has read all messages below it
+	if offsets[0] == 0 {
+		return
+	}
+
+	//log.Printf("stream(debug): truncate topic %q to offset %d: %v\n", key, offsets[0]-1, topic)
 
-	topic.Truncate(offsets[0])
+	if err := topic.Truncate(offsets[0] - 1); err != nil {
+		log.Printf("stream: failed to truncate topic %q to offset %d: %v\n", key, offsets[0]-1, err)
+	}
 }
@@ -3,8 +3,14 @@ package stream
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
 	"sync"
 	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
 )
 
 func TestStream_Subscribe_Groups(t *testing.T) {
@@ -13,13 +19,13 @@ func TestStream_Subscribe_Groups(t *testing.T) {
 	stream := New()
 
 	group1 := make(chan *Message, 1)
-	stream.SubscribeN("topic1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+	stream.SubscribeN("topic1", "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
 		group1 <- msg
 		return nil
 	}), 1)
 
 	group2 := make(chan *Message, 1)
-	stream.SubscribeN("topic1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+	stream.SubscribeN("topic1", "group2", ProcessorFunc(func(ctx context.Context, msg *Message) error {
 		group2 <- msg
 		return nil
 	}), 1)
@@ -67,7 +73,7 @@ func TestStream_Compact(t *testing.T) {
 	waiter := make(chan struct{}, 1)
 
 	group1 := make(chan *Message)
-	stream.SubscribeN("topic1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+	stream.SubscribeN("topic1", "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
 		waiter <- struct{}{}
 		group1 <- msg
 		return nil
@@ -80,10 +86,21 @@ func TestStream_Compact(t *testing.T) {
 	// note, "A" isn't fully processed yet, because sending to group1 above is blocked
 	<-waiter
 
-	// compact must remove message "A" only, as it's the only one that is processed (see waiter's note above)
+	topic1 := stream.Topic("topic1")
+
+	// compact must keep message "A", as it isn't acknowledged yet (see waiter's note above)
 	stream.Compact()
 
-	topic1 := stream.Topic("topic1")
+	if _, ok := topic1.DataAt(0); !ok {
+		t.Errorf("offset 0: want to exist, got %v", ok)
+	}
+
+	// finish processing "A", and wait "B" to be seen in group1 subscriber
+	<-group1
+	<-waiter
+
+	// compact must remove message "A" only, as it's the only one that is processed
+	stream.Compact()
 
 	_, ok := topic1.DataAt(0)
 	if ok {
@@ -98,8 +115,392 @@ func TestStream_Compact(t *testing.T) {
 	}
 }
 
+func TestStream_Subscribe_Redeliver(t *testing.T) {
+	ctx := context.Background()
+
+	stream := New()
+	defer stream.Stop()
+
+	var attempts int
+	group1 := make(chan *Message)
+	stream.SubscribeN("topic1", "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		if msg.Offset == 0 {
+			attempts++
+			if attempts == 1 {
+				return xerrors.New("failed")
+			} else if attempts == 2 {
+				msg.Nack()
+				return nil
+			}
+		}
+		group1 <- msg
+		return nil
+	}), 1, WithRetry(RetryPolicy{}))
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'A'}))
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'B'}))
+
+	// "A" is delivered again after "B", but committed offset doesn't advance past "A", until it's acknowledged
+	// note, sending to group1 above is blocked until the message is received
+	assertMessage(t, <-group1, 1, []byte{'B'})
+	if want, got := []int64{0}, stream.Topic("topic1").Offsets(); !equalOffsets(want, got) {
+		t.Errorf("offsets: want %v, got %v", want, got)
+	}
+
+	assertMessage(t, <-group1, 0, []byte{'A'})
+}
+
+func TestStream_Subscribe_DeadLetter(t *testing.T) {
+	ctx := context.Background()
+
+	stream := New()
+	defer stream.Stop()
+
+	attempts := make(chan *Message, 3)
+	stream.SubscribeN("topic1", "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		attempts <- msg
+		if msg.Data[0] == 'B' {
+			return Permanent(xerrors.New("bad message"))
+		}
+		return xerrors.New("failed")
+	}), 1, WithRetry(RetryPolicy{MaxAttempts: 2}), WithDeadLetter(DeadLetterTopic("topic1")))
+
+	dlq := make(chan DeadLetter, 2)
+	stream.SubscribeN(DeadLetterTopic("topic1"), "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		var dl DeadLetter
+		if err := json.Unmarshal(msg.Data, &dl); err != nil {
+			t.Error(err)
+		}
+		dlq <- dl
+		return nil
+	}), 1)
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'A'}))
+
+	// "A" is moved to the dead-letter topic after all attempts
+	assertMessage(t, <-attempts, 0, []byte{'A'})
+	assertMessage(t, <-attempts, 0, []byte{'A'})
+
+	dl := <-dlq
+	if want, got := 2, dl.Attempts; want != got {
+		t.Errorf("attempts: want %v, got %v", want, got)
+	}
+	if want, got := "failed", dl.Error; want != got {
+		t.Errorf("error: want %q, got %q", want, got)
+	}
+	if want, got := []byte{'A'}, dl.Data; !bytes.Equal(want, got) {
+		t.Errorf("data: want %v, got %v", want, got)
+	}
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'B'}))
+
+	// "B" failed permanently, so it isn't retried
+	assertMessage(t, <-attempts, 1, []byte{'B'})
+
+	dl = <-dlq
+	if want, got := "topic1", dl.Topic; want != got {
+		t.Errorf("topic: want %q, got %q", want, got)
+	}
+	if want, got := int64(1), dl.Offset; want != got {
+		t.Errorf("offset: want %v, got %v", want, got)
+	}
+	if want, got := 1, dl.Attempts; want != got {
+		t.Errorf("attempts: want %v, got %v", want, got)
+	}
+}
+
+func TestStream_ResetGroup(t *testing.T) {
+	ctx := context.Background()
+
+	stream := New()
+	defer stream.Stop()
+
+	group1 := make(chan *Message, 3)
+	stream.SubscribeN("topic1", "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		group1 <- msg
+		return nil
+	}), 1)
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'A'}))
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'B'}))
+
+	assertMessage(t, <-group1, 0, []byte{'A'})
+	assertMessage(t, <-group1, 1, []byte{'B'})
+
+	since := time.Now()
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'C'}))
+	assertMessage(t, <-group1, 2, []byte{'C'})
+
+	offset, err := stream.ResetGroup("topic1", "group1", 1)
+	assertNoError(t, err)
+	if offset != 1 {
+		t.Errorf("reset: want offset 1, got %v", offset)
+	}
+
+	// group1 reads messages again, starting from "B"
+	assertMessage(t, <-group1, 1, []byte{'B'})
+	assertMessage(t, <-group1, 2, []byte{'C'})
+
+	offset, err = stream.ResetGroupTime("topic1", "group1", since)
+	assertNoError(t, err)
+	if offset != 2 {
+		t.Errorf("reset by time: want offset 2, got %v", offset)
+	}
+
+	assertMessage(t, <-group1, 2, []byte{'C'})
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'D'}))
+	assertMessage(t, <-group1, 3, []byte{'D'})
+
+	if _, err := stream.ResetGroup("topic1", "group2", 0); !xerrors.Is(err, ErrNotFound) {
+		t.Errorf("reset unknown group: want ErrNotFound, got %v", err)
+	}
+}
+
+func TestStream_Redrive(t *testing.T) {
+	ctx := context.Background()
+
+	stream := New()
+	defer stream.Stop()
+
+	var failed bool
+	group1 := make(chan *Message, 1)
+	stream.SubscribeN("topic1", "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		if !failed {
+			failed = true
+			return Permanent(xerrors.New("bad message"))
+		}
+		group1 <- msg
+		return nil
+	}), 1, WithDeadLetter(DeadLetterTopic("topic1")))
+
+	dlq := make(chan *Message, 1)
+	stream.SubscribeN(DeadLetterTopic("topic1"), "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		dlq <- msg
+		return nil
+	}), 1)
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'A'}))
+
+	// group2 processed the message, so it skips the redriven one
+	group2 := make(chan *Message, 2)
+	stream.SubscribeN("topic1", "group2", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		group2 <- msg
+		return nil
+	}), 1)
+
+	msg := <-dlq
+
+	dl, err := stream.Redrive(ctx, DeadLetterTopic("topic1"), msg.Offset)
+	assertNoError(t, err)
+	if want, got := "topic1", dl.Topic; want != got {
+		t.Errorf("redrive: want topic %q, got %q", want, got)
+	}
+
+	redriven := <-group1
+	assertMessage(t, redriven, 1, []byte{'A'})
+	if want, got := "group1", redriven.Headers.Get(HeaderRedriveGroup); want != got {
+		t.Errorf("redrive: want group header %q, got %q", want, got)
+	}
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'B'}))
+	assertMessage(t, <-group2, 0, []byte{'A'})
+	assertMessage(t, <-group2, 2, []byte{'B'})
+}
+
+func TestStream_Subscribe_Filter(t *testing.T) {
+	ctx := context.Background()
+
+	stream := New()
+	defer stream.Stop()
+
+	processed := make(chan *Message)
+	err := stream.SubscribeN("topic1", "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		processed <- msg
+		return nil
+	}), 1, WithFilter(func(msg *Message) bool {
+		return msg.Headers.Get("action") == "opened"
+	}))
+	assertNoError(t, err)
+
+	_, err = stream.Publish(ctx, "topic1", []byte{'A'}, Headers{"action": "closed"})
+	assertNoError(t, err)
+	_, err = stream.Publish(ctx, "topic1", []byte{'B'}, Headers{"action": "opened"})
+	assertNoError(t, err)
+
+	select {
+	case msg := <-processed:
+		assertMessage(t, msg, 1, []byte{'B'})
+		if want, got := "opened", msg.Headers.Get("action"); want != got {
+			t.Errorf("header action: want %q, got %q", want, got)
+		}
+		if msg.Time.IsZero() {
+			t.Errorf("want message time to be set")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for a message")
+	}
+}
+
+func TestStream_Subscribe_Throttle(t *testing.T) {
+	ctx := context.Background()
+
+	stream := New()
+	defer stream.Stop()
+
+	paused := make(chan struct{})
+	processed := make(chan *Message)
+	err := stream.SubscribeN("topic1", "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		processed <- msg
+		return nil
+	}), 1, WithThrottle(func(ctx context.Context, msg *Message) error {
+		// only the message "A" is paused
+		if string(msg.Data) != "A" {
+			return nil
+		}
+		select {
+		case <-paused:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}))
+	assertNoError(t, err)
+
+	err = stream.Push(ctx, "topic1", []byte{'A'})
+	assertNoError(t, err)
+
+	select {
+	case <-processed:
+		t.Fatal("want no message to be processed, while the subscription is paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(paused)
+
+	select {
+	case msg := <-processed:
+		assertMessage(t, msg, 0, []byte{'A'})
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for a message")
+	}
+
+	err = stream.Push(ctx, "topic1", []byte{'B'})
+	assertNoError(t, err)
+
+	select {
+	case msg := <-processed:
+		assertMessage(t, msg, 1, []byte{'B'})
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for a message")
+	}
+}
+
 func assertNoError(t *testing.T, err error) {
 	if err != nil {
 		t.Errorf("want error to be nil, got %v", err)
 	}
 }
+
+func TestStream_Open_Recover(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "hookeye-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stream, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertNoError(t, stream.Push(ctx, "topic/1", []byte{'A'}))
+	assertNoError(t, stream.Push(ctx, "topic/1", []byte{'B'}))
+	assertNoError(t, stream.Stop())
+
+	stream, err = Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group1 := make(chan *Message, 2)
+	assertNoError(t, stream.SubscribeN("topic/1", "group1", ProcessorFunc(func(ctx context.Context, msg *Message) error {
+		group1 <- msg
+		return nil
+	}), 1))
+
+	for i := 0; i < 2; i++ {
+		msg := <-group1
+		if want, got := []byte{byte('A' + i)}, msg.Data; !bytes.Equal(want, got) {
+			t.Errorf("(i %v): want %v, got %v", i, want, got)
+		}
+	}
+
+	assertNoError(t, stream.Stop())
+}
+
+func TestStream_Open_GroupOffsets(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "hookeye-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	subscribe := func(stream *Stream, name string) <-chan *Message {
+		group := make(chan *Message, 3)
+		assertNoError(t, stream.SubscribeN("topic1", name, ProcessorFunc(func(ctx context.Context, msg *Message) error {
+			group <- msg
+			return nil
+		}), 1))
+		return group
+	}
+
+	stream, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group1 := subscribe(stream, "group1")
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'A'}))
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'B'}))
+
+	assertMessage(t, <-group1, 0, []byte{'A'})
+	assertMessage(t, <-group1, 1, []byte{'B'})
+
+	assertNoError(t, stream.Stop())
+
+	stream, err = Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Stop()
+
+	assertNoError(t, stream.Push(ctx, "topic1", []byte{'C'}))
+
+	// group1 resumes after the messages it has read, while new group2 reads from the start
+	group1 = subscribe(stream, "group1")
+	group2 := subscribe(stream, "group2")
+
+	assertMessage(t, <-group1, 2, []byte{'C'})
+
+	assertMessage(t, <-group2, 0, []byte{'A'})
+	assertMessage(t, <-group2, 1, []byte{'B'})
+	assertMessage(t, <-group2, 2, []byte{'C'})
+}
+
+func assertMessage(t *testing.T, msg *Message, wantOffset int64, wantData []byte) {
+	t.Helper()
+
+	if msg.Offset != wantOffset {
+		t.Errorf("message offset: want %v, got %v", wantOffset, msg.Offset)
+	}
+	if !bytes.Equal(msg.Data, wantData) {
+		t.Errorf("message %d: data want %v, got %v", msg.Offset, wantData, msg.Data)
+	}
+}
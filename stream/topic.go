@@ -3,120 +3,305 @@ package stream
 import (
 	"context"
 	"fmt"
+	"log"
+	"sort"
 	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 )
 
 type Topic struct {
+	key string
+
 	groupsMu sync.RWMutex
 	groups   []*Group
 
 	groupsOffsetsMu sync.Mutex
-	groupsOffsets   []int64
+	groupsOffsets   map[string]int64
+	offsetStore     OffsetStore
+
+	// dataMu guards the log
+	dataMu sync.RWMutex
+	log    Log
+	mem    memLog
+}
 
-	dataMu     sync.RWMutex
-	data       [][]byte
-	index      map[int64]int
-	nextOffset int64
+func newTopic(key string, log Log, offsetStore OffsetStore) *Topic {
+	return &Topic{
+		key:         key,
+		log:         log,
+		offsetStore: offsetStore,
+	}
 }
 
-func (topic *Topic) NewGroup() *Group {
+// storage returns the log of the topic. Topic's zero value keeps messages in memory.
+func (topic *Topic) storage() Log {
+	if topic.log != nil {
+		return topic.log
+	}
+	return &topic.mem
+}
+
+// Group returns the consumer group by its name, creating the group if it doesn't exist.
+// New group receives every retained message, starting from the offset the group committed previously,
+// and all messages pushed later.
+func (topic *Topic) Group(name string) (*Group, error) {
+	// hold the log, so no message is pushed between reading its bounds and registering the group
+	topic.dataMu.RLock()
+	defer topic.dataMu.RUnlock()
+
 	topic.groupsMu.Lock()
 	defer topic.groupsMu.Unlock()
 
+	for _, group := range topic.groups {
+		if group.name == name {
+			return group, nil
+		}
+	}
+
+	first, next := topic.storage().Bounds()
+
+	if topic.offsetStore != nil {
+		offset, ok, err := topic.offsetStore.Load(topic.key, name)
+		if err != nil {
+			return nil, xerrors.Errorf("could not load offset of group %q: %w", name, err)
+		}
+		if ok && offset > first {
+			first = offset
+		}
+	}
+
 	group := &Group{
-		head:  make(chan int64, 1),
-		topic: topic,
+		name:      name,
+		head:      make(chan int64, 1),
+		committed: first,
+		next:      next,
+		topic:     topic,
+	}
+	for offset := first; offset < next; offset++ {
+		group.tail = append(group.tail, offset)
 	}
+	if len(group.tail) > 0 {
+		group.tryPushLocked()
+	}
+
 	topic.groups = append(topic.groups, group)
-	topic.groupsOffsets = append(topic.groupsOffsets, 0)
 
-	group.id = len(topic.groups) - 1
+	topic.groupsOffsetsMu.Lock()
+	if topic.groupsOffsets == nil {
+		topic.groupsOffsets = make(map[string]int64)
+	}
+	topic.groupsOffsets[name] = first
+	topic.groupsOffsetsMu.Unlock()
+
+	return group, nil
+}
 
-	return group
+func (topic *Topic) group(name string) *Group {
+	topic.groupsMu.RLock()
+	defer topic.groupsMu.RUnlock()
+
+	for _, group := range topic.groups {
+		if group.name == name {
+			return group
+		}
+	}
+	return nil
+}
+
+// ResetGroup moves group's committed offset, so the group reads messages starting from the offset again,
+// or skips the messages below it. The offset is limited to the bounds of retained messages; ResetGroup returns
+// the offset, the group was reset to.
+// Messages, that were being processed when the group was reset, aren't committed or delivered again.
+func (topic *Topic) ResetGroup(name string, offset int64) (int64, error) {
+	// hold the log, so no message is pushed between reading its bounds and resetting the group
+	topic.dataMu.RLock()
+	defer topic.dataMu.RUnlock()
+
+	group := topic.group(name)
+	if group == nil {
+		return 0, xerrors.Errorf("group %q: %w", name, ErrNotFound)
+	}
+
+	first, next := topic.storage().Bounds()
+	if offset < first {
+		offset = first
+	} else if offset > next {
+		offset = next
+	}
+
+	group.mu.Lock()
+	defer group.mu.Unlock()
+
+	group.resetLocked(offset, next)
+
+	topic.groupsOffsetsMu.Lock()
+	defer topic.groupsOffsetsMu.Unlock()
+
+	topic.groupsOffsets[name] = offset
+
+	if topic.offsetStore == nil {
+		return offset, nil
+	}
+	return offset, topic.offsetStore.Save(topic.key, name, offset)
+}
+
+// OffsetAt returns the offset of the first retained message, that was pushed at or after t.
+// If there is no such message, it returns the offset the next message will get.
+func (topic *Topic) OffsetAt(t time.Time) (offset int64, err error) {
+	topic.dataMu.RLock()
+	defer topic.dataMu.RUnlock()
+
+	first, next := topic.storage().Bounds()
+
+	i := sort.Search(int(next-first), func(i int) bool {
+		e, ok, rerr := topic.storage().Read(first + int64(i))
+		if rerr != nil {
+			err = rerr
+			return true
+		}
+		return !ok || !e.Time.Before(t)
+	})
+	return first + int64(i), err
 }
 
 func (topic *Topic) Push(ctx context.Context, data []byte) error {
+	_, err := topic.Publish(ctx, data, nil)
+	return err
+}
+
+// Publish is like Push, but it stores the headers with the message and returns the offset assigned to the message.
+func (topic *Topic) Publish(ctx context.Context, data []byte, headers Headers) (offset int64, err error) {
 	topic.dataMu.Lock()
-	offset := topic.push(data)
-	topic.dataMu.Unlock()
+	offset, err = topic.storage().Append(data, headers)
+	if err != nil {
+		topic.dataMu.Unlock()
+		return 0, xerrors.Errorf("could not append to log: %w", err)
+	}
 
 	topic.groupsMu.RLock()
 	groups := topic.groups
 	topic.groupsMu.RUnlock()
 
+	topic.dataMu.Unlock()
+
 	// simply fan-out for now
 	for _, group := range groups {
 		group.Push(ctx, offset)
 	}
 
-	return nil
+	return offset, nil
 }
 
-func (topic *Topic) push(data []byte) (offset int64) {
-	offset = topic.nextOffset
-	topic.nextOffset++
-
-	if topic.index == nil {
-		topic.index = make(map[int64]int)
+func (topic *Topic) DataAt(offset int64) (data []byte, ok bool) {
+	e, ok, err := topic.Read(offset)
+	if err != nil {
+		log.Printf("stream: failed to read offset %d: %v\n", offset, err)
+		return nil, false
 	}
+	return e.Data, ok
+}
 
-	topic.index[offset] = len(topic.data)
-	topic.data = append(topic.data, data)
+// Read returns the entry stored at offset. It returns false if offset isn't retained by the topic.
+func (topic *Topic) Read(offset int64) (e Entry, ok bool, err error) {
+	topic.dataMu.RLock()
+	defer topic.dataMu.RUnlock()
 
-	return offset
+	return topic.storage().Read(offset)
 }
 
-func (topic *Topic) DataAt(offset int64) (data []byte, ok bool) {
+// TopicStats describes the state of a topic and its consumer groups.
+type TopicStats struct {
+	Key string `json:"key"`
+	// HeadOffset is the offset of the first retained message.
+	HeadOffset int64 `json:"head_offset"`
+	// TailOffset is the offset the next pushed message will get.
+	TailOffset int64        `json:"tail_offset"`
+	Messages   int64        `json:"messages"`
+	Bytes      int64        `json:"bytes"`
+	Groups     []GroupStats `json:"groups"`
+}
+
+type GroupStats struct {
+	Name string `json:"name"`
+	// CommittedOffset is the offset of the first message, that isn't acknowledged by the group.
+	CommittedOffset int64 `json:"committed_offset"`
+	// Lag is the number of messages, the group has to process to catch up with the topic.
+	Lag int64 `json:"lag"`
+}
+
+func (topic *Topic) Stats() TopicStats {
 	topic.dataMu.RLock()
-	defer topic.dataMu.RUnlock()
+	first, next := topic.storage().Bounds()
+	size := topic.storage().Size()
+	topic.dataMu.RUnlock()
 
-	pos, ok := topic.index[offset]
-	if !ok {
-		return nil, ok
+	stats := TopicStats{
+		Key:        topic.key,
+		HeadOffset: first,
+		TailOffset: next,
+		Messages:   next - first,
+		Bytes:      size,
+	}
+
+	topic.groupsMu.RLock()
+	groups := topic.groups
+	topic.groupsMu.RUnlock()
+
+	topic.groupsOffsetsMu.Lock()
+	for _, group := range groups {
+		committed := topic.groupsOffsets[group.name]
+		stats.Groups = append(stats.Groups, GroupStats{
+			Name:            group.name,
+			CommittedOffset: committed,
+			Lag:             next - committed,
+		})
 	}
-	data = topic.data[pos]
+	topic.groupsOffsetsMu.Unlock()
 
-	return data, true
+	return stats
 }
 
+// Offsets returns offsets committed by topic's groups.
 func (topic *Topic) Offsets() (offsets []int64) {
 	topic.groupsOffsetsMu.Lock()
-	offsets = append(offsets, topic.groupsOffsets...)
+	for _, offset := range topic.groupsOffsets {
+		offsets = append(offsets, offset)
+	}
 	topic.groupsOffsetsMu.Unlock()
 	return offsets
 }
 
-func (topic *Topic) CommitOffset(groupID int, offset int64) {
-	topic.dataMu.RLock()
-	nextOffset := topic.nextOffset
-	topic.dataMu.RUnlock()
-
+// CommitOffset marks messages below offset as read by the group. Committed offset never moves backwards.
+func (topic *Topic) CommitOffset(group string, offset int64) error {
 	topic.groupsOffsetsMu.Lock()
 	defer topic.groupsOffsetsMu.Unlock()
 
-	oldOffset := topic.groupsOffsets[groupID]
-	if oldOffset > offset && nextOffset > offset {
-		return
+	if offset <= topic.groupsOffsets[group] {
+		return nil
 	}
-	topic.groupsOffsets[groupID] = offset
+	topic.groupsOffsets[group] = offset
+
+	if topic.offsetStore == nil {
+		return nil
+	}
+	return topic.offsetStore.Save(topic.key, group, offset)
 }
 
-func (topic *Topic) Truncate(offset int64) {
+// Truncate removes messages up to and including offset.
+func (topic *Topic) Truncate(offset int64) error {
 	topic.dataMu.Lock()
 	defer topic.dataMu.Unlock()
 
-	pos := topic.index[offset] + 1
-	topic.data = topic.data[pos:]
+	return topic.storage().Truncate(offset)
+}
 
-	for ixOffset, ixPos := range topic.index {
-		if ixOffset <= offset {
-			delete(topic.index, ixOffset)
-		} else {
-			topic.index[ixOffset] = ixPos - pos
-		}
-	}
+func (topic *Topic) Close() error {
+	topic.dataMu.Lock()
+	defer topic.dataMu.Unlock()
+
+	return topic.storage().Close()
 }
 
 type Group struct {
@@ -124,43 +309,185 @@ type Group struct {
 	head chan int64
 	tail []int64
 
-	// id of the group in the topic
-	id    int
+	// committed is the offset, all messages below which are acknowledged
+	committed int64
+	// acked holds acknowledged offsets above committed
+	acked map[int64]struct{}
+	// attempts counts deliveries of the messages, that aren't acknowledged yet
+	attempts map[int64]int
+	// next is the offset of the next message the group expects to be pushed
+	next int64
+	// generation changes every time the group is reset
+	generation int
+
+	name  string
 	topic *Topic
 }
 
 func (group *Group) Pop(ctx context.Context) (offset int64, data []byte, err error) {
+	msg, err := group.pop(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	return msg.Offset, msg.Data, nil
+}
+
+func (group *Group) pop(ctx context.Context) (*Message, error) {
+	var offset int64
 	select {
 	case offset = <-group.head:
 	case <-ctx.Done():
-		return 0, nil, ctx.Err()
+		return nil, ctx.Err()
 	}
 
 	group.mu.Lock()
 	if len(group.tail) > 0 {
 		group.tryPushLocked()
 	}
+	if group.attempts == nil {
+		group.attempts = make(map[int64]int)
+	}
+	group.attempts[offset]++
+	attempt := group.attempts[offset]
+	generation := group.generation
 	group.mu.Unlock()
 
-	data, ok := group.topic.DataAt(offset)
+	e, ok, err := group.topic.Read(offset)
+	if err != nil {
+		log.Printf("stream: failed to read offset %d: %v\n", offset, err)
+	}
 	if !ok {
-		return 0, nil, xerrors.New("not found")
+		// nothing to deliver, so don't hold committed offset on it
+		group.ack(offset, generation)
+		return nil, xerrors.Errorf("offset %d not found", offset)
+	}
+
+	msg := &Message{
+		Offset:     offset,
+		Time:       e.Time,
+		Headers:    e.Headers,
+		Data:       e.Data,
+		Attempt:    attempt,
+		group:      group,
+		generation: generation,
 	}
+	return msg, nil
+}
 
-	group.topic.CommitOffset(group.id, offset)
+// Ack marks the message at offset as processed. Group's committed offset advances
+// past all contiguous acknowledged messages, so these messages aren't delivered again.
+func (group *Group) Ack(offset int64) {
+	group.mu.Lock()
+	generation := group.generation
+	group.mu.Unlock()
 
-	return offset, data, nil
+	group.ack(offset, generation)
+}
+
+func (group *Group) ack(offset int64, generation int) {
+	group.mu.Lock()
+	if generation != group.generation {
+		// the group was reset since the message was delivered
+		group.mu.Unlock()
+		return
+	}
+
+	delete(group.attempts, offset)
+	if offset < group.committed {
+		group.mu.Unlock()
+		return
+	}
+
+	if group.acked == nil {
+		group.acked = make(map[int64]struct{})
+	}
+	group.acked[offset] = struct{}{}
+
+	committed := group.committed
+	for {
+		if _, ok := group.acked[committed]; !ok {
+			break
+		}
+		delete(group.acked, committed)
+		committed++
+	}
+	advanced := committed > group.committed
+	group.committed = committed
+	group.mu.Unlock()
+
+	if !advanced {
+		return
+	}
+	if err := group.topic.CommitOffset(group.name, committed); err != nil {
+		log.Printf("stream: failed to commit offset %d of group %s: %v\n", committed, group, err)
+	}
+}
+
+// Nack returns the message at offset to the group, so it's delivered again.
+func (group *Group) Nack(offset int64) {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+
+	group.nackLocked(offset, group.generation)
+}
+
+func (group *Group) nack(offset int64, generation int) {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+
+	group.nackLocked(offset, generation)
+}
+
+func (group *Group) nackLocked(offset int64, generation int) {
+	if generation != group.generation {
+		return
+	}
+
+	group.tail = append(group.tail, offset)
+
+	group.tryPushLocked()
 }
 
 func (group *Group) Push(ctx context.Context, offset int64) {
 	group.mu.Lock()
 	defer group.mu.Unlock()
 
+	// the offset is already in the tail, if the group was created or reset after the message was appended to the log
+	if offset < group.next {
+		return
+	}
+	group.next = offset + 1
+
 	group.tail = append(group.tail, offset)
 
 	group.tryPushLocked()
 }
 
+// resetLocked drops the messages, waiting to be delivered, and schedules the messages in [offset, next) instead.
+func (group *Group) resetLocked(offset, next int64) {
+	group.generation++
+
+	// drop the message, waiting in the head
+	select {
+	case <-group.head:
+	default:
+	}
+
+	group.tail = nil
+	for o := offset; o < next; o++ {
+		group.tail = append(group.tail, o)
+	}
+	group.next = next
+
+	group.committed = offset
+	group.acked = nil
+	group.attempts = nil
+
+	if len(group.tail) > 0 {
+		group.tryPushLocked()
+	}
+}
+
 func (group *Group) tryPushLocked() {
 	select {
 	case group.head <- group.tail[0]:
@@ -170,5 +497,5 @@ func (group *Group) tryPushLocked() {
 }
 
 func (group *Group) String() string {
-	return fmt.Sprintf("<Group:%d>", group.id)
+	return fmt.Sprintf("<Group:%s>", group.name)
 }
@@ -10,11 +10,17 @@ func TestTopic_Truncate(t *testing.T) {
 	ctx := context.Background()
 
 	topic := &Topic{}
-	group1 := topic.NewGroup()
-	group2 := topic.NewGroup()
+	group1, err := topic.Group("group1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	group2, err := topic.Group("group2")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	for i := 0; i < 10; i++ {
-		err := topic.Push(ctx, []byte{byte('A' + i)})
+		err = topic.Push(ctx, []byte{byte('A' + i)})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -30,7 +36,7 @@ func TestTopic_Truncate(t *testing.T) {
 
 	topic.Truncate(2) // truncate up to 'C'
 
-	err := topic.Push(ctx, []byte{'x'})
+	err = topic.Push(ctx, []byte{'x'})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const defaultAdminURL = "http://localhost:10081"
+
+const streamUsage = `usage: hookeye stream <command> [flags]
+
+Commands:
+  replay    reset consumer group of a topic to an offset or a timestamp
+  redrive   push a message from dead-letter topic back to its source topic
+
+Run "hookeye stream <command> -help" for command's flags.
+`
+
+// runStreamCommand runs "hookeye stream" commands, that manage the stream of a running hookeye via its admin API.
+func runStreamCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, streamUsage)
+		return xerrors.New("no command")
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "replay":
+		return runStreamReplay(args)
+	case "redrive":
+		return runStreamRedrive(args)
+	default:
+		fmt.Fprint(os.Stderr, streamUsage)
+		return xerrors.Errorf("unknown command %q", cmd)
+	}
+}
+
+func runStreamReplay(args []string) error {
+	fs := flag.NewFlagSet("stream replay", flag.ExitOnError)
+
+	adminURL := fs.String("admin-url", defaultAdminURL, "hookeye admin API url")
+	topic := fs.String("topic", "", "topic to replay")
+	group := fs.String("group", "", "consumer group to reset")
+	offset := fs.Int64("offset", -1, "offset to reset the group to")
+	since := fs.String("since", "", "reset the group to the first message received at or after the time, in RFC 3339 format")
+
+	fs.Parse(args)
+
+	if *topic == "" || *group == "" {
+		return xerrors.New("both -topic and -group are required")
+	}
+
+	params := url.Values{
+		"topic": {*topic},
+		"group": {*group},
+	}
+	switch {
+	case *offset >= 0 && *since == "":
+		params.Set("offset", strconv.FormatInt(*offset, 10))
+	case *offset < 0 && *since != "":
+		params.Set("since", *since)
+	default:
+		return xerrors.New("exactly one of -offset and -since is required")
+	}
+
+	return postAdmin(*adminURL, "/admin/stream/reset", params)
+}
+
+func runStreamRedrive(args []string) error {
+	fs := flag.NewFlagSet("stream redrive", flag.ExitOnError)
+
+	adminURL := fs.String("admin-url", defaultAdminURL, "hookeye admin API url")
+	topic := fs.String("topic", "", "dead-letter topic, e.g. github/issues.dlq")
+	offset := fs.Int64("offset", -1, "offset of the message in dead-letter topic")
+
+	fs.Parse(args)
+
+	if *topic == "" || *offset < 0 {
+		return xerrors.New("both -topic and -offset are required")
+	}
+
+	params := url.Values{
+		"topic":  {*topic},
+		"offset": {strconv.FormatInt(*offset, 10)},
+	}
+	return postAdmin(*adminURL, "/admin/stream/redrive", params)
+}
+
+// postAdmin calls admin API and prints the response to stdout.
+func postAdmin(adminURL, path string, params url.Values) error {
+	u := strings.TrimSuffix(adminURL, "/") + path + "?" + params.Encode()
+
+	resp, err := http.Post(u, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("admin API responded %s: %s", resp.Status, body)
+	}
+
+	_, err = os.Stdout.Write(body)
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adjust/hookeye/stream"
+)
+
+// fakeAdmin is a fake admin API, that records the requests it receives.
+type fakeAdmin struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	status   int
+}
+
+func (f *fakeAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r)
+	if f.status != 0 {
+		http.Error(w, "failed", f.status)
+		return
+	}
+	w.Write([]byte("{}\n"))
+}
+
+func TestRunStreamReplay(t *testing.T) {
+	cases := []struct {
+		name       string
+		args       []string
+		wantParams url.Values
+		wantErr    string
+	}{
+		{
+			"offset",
+			[]string{"-topic", "github/issues", "-group", "projects", "-offset", "0"},
+			url.Values{"topic": {"github/issues"}, "group": {"projects"}, "offset": {"0"}},
+			"",
+		},
+		{
+			"since",
+			[]string{"-topic", "github/issues", "-group", "projects", "-since", "2026-10-01T00:00:00Z"},
+			url.Values{"topic": {"github/issues"}, "group": {"projects"}, "since": {"2026-10-01T00:00:00Z"}},
+			"",
+		},
+		{
+			"offset and since",
+			[]string{"-topic", "github/issues", "-group", "projects", "-offset", "0", "-since", "2026-10-01T00:00:00Z"},
+			nil,
+			"exactly one of -offset and -since is required",
+		},
+		{
+			"no offset or since",
+			[]string{"-topic", "github/issues", "-group", "projects"},
+			nil,
+			"exactly one of -offset and -since is required",
+		},
+		{
+			"no group",
+			[]string{"-topic", "github/issues", "-offset", "0"},
+			nil,
+			"both -topic and -group are required",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeAdmin{}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+
+			err := runStreamReplay(append([]string{"-admin-url", srv.URL}, tc.args...))
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("want error %q, got %v", tc.wantErr, err)
+				}
+				if len(fake.requests) != 0 {
+					t.Errorf("want no requests, got %d", len(fake.requests))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(fake.requests) != 1 {
+				t.Fatalf("want 1 request, got %d", len(fake.requests))
+			}
+			req := fake.requests[0]
+			if req.Method != http.MethodPost || req.URL.Path != "/admin/stream/reset" {
+				t.Errorf("want POST /admin/stream/reset, got %s %s", req.Method, req.URL.Path)
+			}
+			if got := req.URL.Query(); got.Encode() != tc.wantParams.Encode() {
+				t.Errorf("want params %v, got %v", tc.wantParams, got)
+			}
+		})
+	}
+}
+
+func TestRunStreamReplay_AdminHandler(t *testing.T) {
+	at := newAdminHandlerTest(t)
+	defer at.Close()
+
+	group1 := make(chan *stream.Message, 2)
+	at.stream.SubscribeN("topic1", "group1", stream.ProcessorFunc(func(ctx context.Context, msg *stream.Message) error {
+		group1 <- msg
+		return nil
+	}), 1)
+
+	at.publish(t, "topic1", "A", nil)
+	<-group1
+
+	if err := runStreamReplay([]string{"-admin-url", at.srv.URL, "-topic", "topic1", "-group", "group1", "-offset", "0"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-group1; msg.Offset != 0 {
+		t.Errorf("replay: want message at offset 0, got %d", msg.Offset)
+	}
+
+	// the admin API responds 404 for unknown group
+	err := runStreamReplay([]string{"-admin-url", at.srv.URL, "-topic", "topic1", "-group", "group2", "-offset", "0"})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("unknown group: want 404 error, got %v", err)
+	}
+}
+
+func TestRunStreamRedrive(t *testing.T) {
+	at := newAdminHandlerTest(t)
+	defer at.Close()
+
+	group1, offset := at.subscribeDeadLetter(t)
+
+	err := runStreamRedrive([]string{"-admin-url", at.srv.URL, "-topic", stream.DeadLetterTopic("topic1"), "-offset", strconv.FormatInt(offset, 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-group1; string(msg.Data) != "A" {
+		t.Errorf("redrive: want message A, got %q", msg.Data)
+	}
+
+	err = runStreamRedrive([]string{"-admin-url", at.srv.URL, "-topic", stream.DeadLetterTopic("topic1")})
+	if err == nil || err.Error() != "both -topic and -offset are required" {
+		t.Errorf("no offset: want error, got %v", err)
+	}
+
+	err = runStreamRedrive([]string{"-admin-url", at.srv.URL, "-topic", stream.DeadLetterTopic("topic2"), "-offset", "0"})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("unknown topic: want 404 error, got %v", err)
+	}
+}
+
+func TestPostAdmin_Error(t *testing.T) {
+	fake := &fakeAdmin{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	err := postAdmin(srv.URL+"/", "/admin/stream/reset", url.Values{"topic": {"topic1"}})
+	if err == nil || !strings.HasPrefix(err.Error(), "admin API responded 500 Internal Server Error: failed") {
+		t.Errorf("want admin API error, got %v", err)
+	}
+	if len(fake.requests) != 1 || fake.requests[0].URL.Path != "/admin/stream/reset" {
+		t.Errorf("want request to /admin/stream/reset, got %v", fake.requests)
+	}
+}
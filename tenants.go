@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adjust/hookeye/github"
+	"github.com/adjust/hookeye/hooks"
+	"github.com/adjust/hookeye/hooks/githubsvc"
+	"github.com/adjust/hookeye/stream"
+	"golang.org/x/xerrors"
+)
+
+// TenantsConfig lists the tenants, e.g. GitHub organizations, hookeye receives webhooks for. It's loaded
+// from a JSON file, e.g.
+//
+//	{
+//	  "tenants": [
+//	    {"name": "adjust", "secrets": ["${ADJUST_GITHUB_SECRET}"], "token": "${ADJUST_GITHUB_TOKEN}", "rules": "/etc/hookeye/adjust.json"},
+//	    {"name": "narqo", "app_id": 42, "app_key": "/etc/hookeye/app.pem", "app_installation_id": 7, "rules": "/etc/hookeye/narqo.json"}
+//	  ]
+//	}
+type TenantsConfig struct {
+	Tenants []TenantConfig `json:"tenants"`
+}
+
+// TenantConfig is a tenant with its own webhook route, secrets, credentials, API endpoints and rules.
+// A secret or a token, written as a reference to environment variable, e.g. "${ADJUST_GITHUB_TOKEN}", is read
+// from the variable; other values are used as is, even if they contain "$".
+type TenantConfig struct {
+	// Name is the name of the tenant; its webhooks are received at "/github/<name>".
+	Name          string   `json:"name"`
+	Secrets       []string `json:"secrets,omitempty"`
+	RequireSHA256 bool     `json:"require_sha256,omitempty"`
+
+	// Token is the personal access token; it's ignored, if AppID is set.
+	Token      string `json:"token,omitempty"`
+	AppID      int64  `json:"app_id,omitempty"`
+	AppKeyFile string `json:"app_key,omitempty"`
+	// AppInstallationID is the installation of the app, the requests, that don't come from a webhook,
+	// are authenticated as, e.g. to check the rules; webhooks are processed as the installation, that sent them.
+	AppInstallationID int64 `json:"app_installation_id,omitempty"`
+
+	// URL is the base URL of GitHub Enterprise Server, the endpoints of GraphQL and REST APIs are derived from
+	// (see github.NewEndpoints). APIEndpoint and RESTEndpoint override the derived endpoints.
+	// If URL is empty, -github.url, -github.api-endpoint and -github.rest-endpoint are used.
+	URL          string `json:"url,omitempty"`
+	APIEndpoint  string `json:"api_endpoint,omitempty"`
+	RESTEndpoint string `json:"rest_endpoint,omitempty"`
+	// CAFile is the PEM file with CA certificates to trust, e.g. of GitHub Enterprise Server;
+	// -github.ca-file is used if it's empty.
+	CAFile string `json:"ca_file,omitempty"`
+
+	// Rules is the file with tenant's hooks rules (see hooks.Rules).
+	Rules string `json:"rules,omitempty"`
+}
+
+// LoadTenants reads the tenants from the file and validates them.
+func LoadTenants(filename string) ([]TenantConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var conf TenantsConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&conf); err != nil {
+		return nil, xerrors.Errorf("could not decode tenants %s: %w", filename, err)
+	}
+
+	if len(conf.Tenants) == 0 {
+		return nil, xerrors.Errorf("no tenants in %s", filename)
+	}
+	seen := make(map[string]bool)
+	for i := range conf.Tenants {
+		tc := &conf.Tenants[i]
+		if !isValidTenantName(tc.Name) {
+			return nil, xerrors.Errorf("tenant %d: bad name %q", i, tc.Name)
+		}
+		if seen[tc.Name] {
+			return nil, xerrors.Errorf("tenant %q is listed twice", tc.Name)
+		}
+		seen[tc.Name] = true
+
+		if tc.Token, err = expandEnv(tc.Token); err != nil {
+			return nil, xerrors.Errorf("tenant %q: token: %w", tc.Name, err)
+		}
+		for j, secret := range tc.Secrets {
+			if tc.Secrets[j], err = expandEnv(secret); err != nil {
+				return nil, xerrors.Errorf("tenant %q: secret %d: %w", tc.Name, j, err)
+			}
+		}
+
+		if tc.AppID == 0 && tc.Token == "" {
+			return nil, xerrors.Errorf("tenant %q: no token or app_id", tc.Name)
+		}
+		if tc.AppID != 0 && tc.AppKeyFile == "" {
+			return nil, xerrors.Errorf("tenant %q: no app_key for app_id", tc.Name)
+		}
+		if tc.AppID != 0 && tc.Rules != "" && tc.AppInstallationID == 0 {
+			return nil, xerrors.Errorf("tenant %q: no app_installation_id to check the rules as", tc.Name)
+		}
+	}
+	return conf.Tenants, nil
+}
+
+// expandEnv returns the value of environment variable, if s is a reference to the variable, e.g. "${GITHUB_TOKEN}".
+// Other values are returned as is.
+func expandEnv(s string) (string, error) {
+	if !strings.HasPrefix(s, "${") || !strings.HasSuffix(s, "}") {
+		return s, nil
+	}
+	name := s[2 : len(s)-1]
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", xerrors.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// isValidTenantName reports whether the name is safe to use in the route and in the names of consumer groups.
+func isValidTenantName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultTenant returns the tenant, configured with command line flags and environment, that receives webhooks
+// at "/github", when hookeye runs without -tenants.
+func defaultTenant(conf Config) TenantConfig {
+	return TenantConfig{
+		Secrets:           conf.GithubSecrets,
+		RequireSHA256:     conf.GithubRequireSHA256,
+		Token:             conf.GithubToken,
+		AppID:             conf.GithubAppID,
+		AppKeyFile:        conf.GithubAppKeyFile,
+		AppInstallationID: conf.GithubAppInstallID,
+		URL:               conf.GithubURL,
+		APIEndpoint:       conf.GithubAPIEndpoint,
+		RESTEndpoint:      conf.GithubRESTEndpoint,
+		CAFile:            conf.GithubCAFile,
+		Rules:             conf.HooksRulesFile,
+	}
+}
+
+// endpoints returns the endpoints of tenant's GitHub. Tenant's settings take precedence over the flags;
+// the endpoint flags are ignored, if the tenant has its own URL.
+func (tc TenantConfig) endpoints(conf Config) (github.Endpoints, error) {
+	baseURL, apiEndpoint, restEndpoint := tc.URL, tc.APIEndpoint, tc.RESTEndpoint
+	if baseURL == "" {
+		baseURL = conf.GithubURL
+		apiEndpoint = firstNonEmpty(apiEndpoint, conf.GithubAPIEndpoint)
+		restEndpoint = firstNonEmpty(restEndpoint, conf.GithubRESTEndpoint)
+	}
+
+	endpoints, err := github.NewEndpoints(baseURL)
+	if err != nil {
+		return github.Endpoints{}, err
+	}
+	endpoints.GraphQL = firstNonEmpty(apiEndpoint, endpoints.GraphQL)
+	endpoints.REST = firstNonEmpty(restEndpoint, endpoints.REST)
+	return endpoints, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Tenant is a configured tenant with its GitHub client and rules.
+type Tenant struct {
+	Name          string
+	Verifier      *SignatureVerifier
+	GithubService *githubsvc.Service
+	Rules         *hooks.RulesStore
+	// GithubHandler receives tenant's webhooks; it's set, when the stream is open.
+	GithubHandler *GithubHandler
+}
+
+// NewTenant creates tenant's GitHub client and loads its rules.
+func NewTenant(ctx context.Context, tc TenantConfig, conf Config) (*Tenant, error) {
+	endpoints, err := tc.endpoints(conf)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := github.NewTransport(firstNonEmpty(tc.CAFile, conf.GithubCAFile))
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimiter := github.NewRateLimiter(conf.GithubRateReserve)
+	rateLimiter.Name = tc.Name
+	httpClient := &http.Client{
+		Timeout:   conf.GithubClientTimeout,
+		Transport: &github.RateLimitTransport{Limiter: rateLimiter, Base: transport},
+	}
+	githubClient := github.NewClient(endpoints.GraphQL, tc.Token, github.WithHTTPClient(httpClient))
+	githubClient.WebURL = endpoints.Web
+	githubClient.RateLimiter = rateLimiter
+	if tc.AppID != 0 {
+		app, err := github.LoadApp(tc.AppID, tc.AppKeyFile, endpoints.REST)
+		if err != nil {
+			return nil, xerrors.Errorf("could not load github app: %w", err)
+		}
+		app.HTTPClient = &http.Client{
+			Timeout:   conf.GithubClientTimeout,
+			Transport: transport,
+		}
+		githubClient.App = app
+		githubClient.InstallationID = tc.AppInstallationID
+	}
+	githubSvc := &githubsvc.Service{
+		Client: githubClient,
+		Cache:  githubsvc.NewCache(conf.GithubCacheSize, conf.GithubCacheTTL, conf.GithubCacheNegTTL),
+	}
+
+	rulesStore := hooks.NewRulesStore(tc.Rules, githubSvc)
+	if err := rulesStore.Load(ctx); err != nil {
+		return nil, xerrors.Errorf("could not load hooks rules: %w", err)
+	}
+
+	return &Tenant{
+		Name: tc.Name,
+		Verifier: &SignatureVerifier{
+			Tenant:        tc.Name,
+			Secrets:       tc.Secrets,
+			RequireSHA256: tc.RequireSHA256 || conf.GithubRequireSHA256,
+		},
+		GithubService: githubSvc,
+		Rules:         rulesStore,
+	}, nil
+}
+
+// tenantGroup returns the name of tenant's consumer group; the default tenant uses the group as is.
+func tenantGroup(group, tenant string) string {
+	if tenant == "" {
+		return group
+	}
+	return group + "/" + tenant
+}
+
+// subscribeOptions returns the options of tenant's subscription to the topic: the subscription processes
+// only tenant's messages and, as processors call GitHub, waits for the rate limit of tenant's token,
+// or of the app's installation, that sent the message, to reset.
+func (t *Tenant) subscribeOptions(topic string, retryPolicy stream.RetryPolicy) []stream.SubscribeOption {
+	return []stream.SubscribeOption{
+		stream.WithRetry(retryPolicy),
+		stream.WithDeadLetter(stream.DeadLetterTopic(topic)),
+		stream.WithThrottle(t.throttle),
+		tenantFilter(t.Name),
+	}
+}
+
+// throttle waits until the rate limit, the message is processed with, resets.
+func (t *Tenant) throttle(ctx context.Context, msg *stream.Message) error {
+	// messages without installation are processed with the token or the default installation
+	installationID, _ := strconv.ParseInt(msg.Headers.Get(hooks.HeaderInstallation), 10, 64)
+	return t.GithubService.Client.InstallationRateLimiter(installationID).Wait(ctx)
+}
+
+// tenantFilter makes the subscription to process only tenant's messages.
+func tenantFilter(tenant string) stream.SubscribeOption {
+	return stream.WithFilter(func(msg *stream.Message) bool {
+		return msg.Headers.Get(hooks.HeaderTenant) == tenant
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTenants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hookeye-tenants")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("HOOKEYE_TEST_TOKEN", "ghp_test")
+	defer os.Unsetenv("HOOKEYE_TEST_TOKEN")
+
+	cases := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"tenants", `{"tenants": [{"name": "adjust", "secrets": ["ab$cd", "${HOOKEYE_TEST_TOKEN"], "token": "${HOOKEYE_TEST_TOKEN}"}, {"name": "narqo", "app_id": 42, "app_key": "app.pem"}]}`, ""},
+		{"no tenants", `{"tenants": []}`, "no tenants"},
+		{"no name", `{"tenants": [{"token": "t"}]}`, "bad name"},
+		{"bad name", `{"tenants": [{"name": "Adjust/1", "token": "t"}]}`, "bad name"},
+		{"duplicate", `{"tenants": [{"name": "adjust", "token": "t"}, {"name": "adjust", "token": "t"}]}`, "listed twice"},
+		{"no credentials", `{"tenants": [{"name": "adjust"}]}`, "no token"},
+		{"no app key", `{"tenants": [{"name": "adjust", "app_id": 42}]}`, "no app_key"},
+		{"no app installation", `{"tenants": [{"name": "adjust", "app_id": 42, "app_key": "app.pem", "rules": "rules.json"}]}`, "no app_installation_id"},
+		{"unset variable", `{"tenants": [{"name": "adjust", "token": "${HOOKEYE_TEST_UNSET}"}]}`, "HOOKEYE_TEST_UNSET is not set"},
+		{"unknown field", `{"tenants": [{"name": "adjust", "token": "t", "secret": "s"}]}`, "unknown field"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(dir, "tenants.json")
+			if err := ioutil.WriteFile(filename, []byte(tc.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			tenants, err := LoadTenants(filename)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("want error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tenants) != 2 {
+				t.Fatalf("want 2 tenants, got %d", len(tenants))
+			}
+			if tenants[0].Token != "ghp_test" {
+				t.Errorf("want token expanded from environment, got %q", tenants[0].Token)
+			}
+			// values, that aren't references to environment variables, are kept as is
+			if secrets := tenants[0].Secrets; secrets[0] != "ab$cd" || secrets[1] != "${HOOKEYE_TEST_TOKEN" {
+				t.Errorf("want literal secrets, got %q", secrets)
+			}
+			if tenants[1].AppID != 42 || tenants[1].AppKeyFile != "app.pem" {
+				t.Errorf("want app 42 with key app.pem, got %+v", tenants[1])
+			}
+		})
+	}
+}
+
+func TestTenantConfig_Endpoints(t *testing.T) {
+	conf := Config{GithubAPIEndpoint: "http://localhost:8080/graphql"}
+
+	cases := []struct {
+		name        string
+		tc          TenantConfig
+		wantGraphQL string
+		wantREST    string
+		wantWeb     string
+	}{
+		{"flags", TenantConfig{}, "http://localhost:8080/graphql", "https://api.github.com", "https://github.com"},
+		{"tenant's endpoint", TenantConfig{APIEndpoint: "http://localhost:9090/graphql"}, "http://localhost:9090/graphql", "https://api.github.com", "https://github.com"},
+		{"enterprise server", TenantConfig{URL: "https://ghe.example.com"}, "https://ghe.example.com/api/graphql", "https://ghe.example.com/api/v3", "https://ghe.example.com"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints, err := tc.tc.endpoints(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if endpoints.GraphQL != tc.wantGraphQL || endpoints.REST != tc.wantREST || endpoints.Web != tc.wantWeb {
+				t.Errorf("want %s, %s, %s, got %+v", tc.wantGraphQL, tc.wantREST, tc.wantWeb, endpoints)
+			}
+		})
+	}
+}